@@ -24,6 +24,10 @@
 // app/posts.gob.gz
 // app/posts.xml.gz
 // app/var/bans.yaml
+// app/var/journal.xml
+// app/var/trash.xml
+// app/var/next-due.txt
+// app/var/history/
 // app/var/error.log
 // app/var/stage/
 // app/var/old/
@@ -71,9 +75,37 @@ func init() {
 func trace(name string) (string, time.Time) { return name, time.Now() }
 func un(name string, start time.Time)       { log.Printf("%s took %s", name, time.Since(start)) }
 
+// o.atom (or its snapshot) plus the not yet compacted journal.
 func LoadFeed() (Feed, error) {
 	defer un(trace("LoadFeed"))
-	if feed, err := FeedFromFileName(fileFeedStorage); err != nil {
+	feed, err := loadFeedCompacted()
+	if err != nil && !os.IsNotExist(err) {
+		return feed, err
+	}
+	// the very first posts may still be only in the journal
+	if recs, err1 := loadJournal(); err1 != nil {
+		if !os.IsNotExist(err1) {
+			return feed, err1
+		}
+	} else {
+		return feed, feed.replay(recs)
+	}
+	return feed, err
+}
+
+func loadFeedCompacted() (Feed, error) {
+	if nil != memCache {
+		if v, err := memCache.load(fileFeedStorage, func(file string) (interface{}, error) { return loadFeedStore(file, fileFeedSnapshot) }); err != nil {
+			return Feed{}, err
+		} else {
+			return v.(Feed).clone(), nil
+		}
+	}
+	return loadFeedStore(fileFeedStorage, fileFeedSnapshot)
+}
+
+func loadFeedFile(file string) (Feed, error) {
+	if feed, err := FeedFromFileName(file); err != nil {
 		return feed, err
 	} else {
 		for _, ent := range feed.Entries {
@@ -92,9 +124,24 @@ func LoadFeed() (Feed, error) {
 
 // are we running cli
 func runCli() bool {
-	if 0 != len(os.Getenv("REQUEST_METHOD")) {
+	if 0 != len(os.Getenv("REQUEST_METHOD")) || isSpawnedFastCGI() {
 		return false
 	}
+	if 1 < len(os.Args) {
+		run := map[string]func([]string) error{
+			"serve":       serve,
+			"fcgi":        serveFastCGI,
+			"restore":     restore,
+			"publish-due": publishDue,
+		}[os.Args[1]]
+		if nil != run {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err)
+				os.Exit(1)
+			}
+			return true
+		}
+	}
 	fmt.Printf("%sv%s+%s#:\n", myselfNamespace, version, GitSHA1)
 
 	cfg, err := LoadConfig()
@@ -123,7 +170,35 @@ func runCli() bool {
 	return true
 }
 
-// evtl. as a server, too: http://www.dav-muz.net/blog/2013/09/how-to-use-go-and-fastcgi/
+// for cli commands modifying the feeds, see e.g. backup.go
+//
+// Takes the base url from the published o/p/index.xml
+func newCliServer() (Server, error) {
+	app := Server{}
+	var err error
+	if app.cfg, err = LoadConfig(); err != nil {
+		return app, err
+	}
+	if app.tz, err = time.LoadLocation(app.cfg.TimeZone); err != nil {
+		return app, err
+	}
+	pub, err := FeedFromFileName(filepath.Join(filepath.FromSlash(uriPubPosts), "index.xml"))
+	if err != nil {
+		return app, fmt.Errorf("couldn't get base url: %s", err)
+	}
+	u, err := url.Parse(string(pub.XmlBase))
+	if err != nil {
+		return app, err
+	}
+	if !u.IsAbs() {
+		return app, fmt.Errorf("base url not absolute: '%s'", pub.XmlBase)
+	}
+	app.url = *u
+	app.cgi = *u.ResolveReference(mustParseURL(cgiName))
+	return app, nil
+}
+
+// see also serve.go and fcgi.go to run as a standalone webserver or FastCGI.
 func main() {
 	if runCli() {
 		return
@@ -147,6 +222,13 @@ func main() {
 		}
 	}
 
+	if isSpawnedFastCGI() {
+		if err := serveFastCGIListener(nil); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	wg := &sync.WaitGroup{}
 	// - check non-write perm of program?
 	// - check non-http read perm on ./app
@@ -188,7 +270,8 @@ func (app Server) IsLoggedIn(now time.Time) bool {
 	return ok && now.Before(time.Unix(timeout, 0))
 }
 
-// Internal storage, not publishing.
+// Internal storage, not publishing. Rewrites o.atom completely and compacts the
+// journal, see SaveEntry for single modifications.
 func (app Server) SaveFeed(feed Feed) error {
 	defer un(trace("Server.SaveFeed"))
 	feed.Id = ""
@@ -196,7 +279,30 @@ func (app Server) SaveFeed(feed Feed) error {
 	feed.Generator = nil
 	feed.Updated = iso8601{}
 	feed.Categories = nil
-	return feed.SaveToFile(fileFeedStorage)
+	if err := app.cfg.rotateBackups(fileFeedStorage, time.Now()); err != nil {
+		return err
+	}
+	if err := feed.SaveToFile(fileFeedStorage); err != nil {
+		return err
+	}
+	// compacted, see journal.go
+	if err := os.Remove(fileFeedJournal); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := saveNextDue(feed); err != nil {
+		log.Printf("couldn't write %s: %s", fileNextDue, err)
+	}
+	if fi, err := os.Stat(fileFeedStorage); err != nil {
+		return err
+	} else if err := saveFeedSnapshot(feed, fi, fileFeedSnapshot); err != nil {
+		// not fatal, gets rebuilt from the Atom file on next load
+		log.Printf("couldn't write snapshot %s: %s", fileFeedSnapshot, err)
+	}
+	if err := saveSearchIndex(feed); err != nil {
+		// not fatal, gets rebuilt on next search
+		log.Printf("couldn't write search index %s: %s", fileSearchIndex, err)
+	}
+	return nil
 }
 
 func (app Server) Posse(en Entry) {
@@ -252,6 +358,22 @@ func (app Server) Posse(en Entry) {
 	}
 }
 
+type cgiEnvKey struct{}
+
+// the CGI variables we care about, set per request when not running as a CGI.
+type cgiEnv struct {
+	ScriptName string
+	PathInfo   string
+}
+
+// SCRIPT_NAME and PATH_INFO either from the request context or the CGI environment.
+func cgiVars(r *http.Request) (scriptName, pathInfo string) {
+	if env, ok := r.Context().Value(cgiEnvKey{}).(cgiEnv); ok {
+		return env.ScriptName, env.PathInfo
+	}
+	return os.Getenv("SCRIPT_NAME"), os.Getenv("PATH_INFO")
+}
+
 func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer un(trace(strings.Join([]string{"v", version, "+", GitSHA1, " ", r.RemoteAddr, " ", r.Method, " ", r.URL.String()}, "")))
@@ -277,7 +399,7 @@ func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
 			log.Printf("request URL not absolute >>> %s <<<", r.URL)
 		}
 
-		path_info := os.Getenv("PATH_INFO")
+		script_name, path_info := cgiVars(r)
 
 		// unpack (nonexisting) static files
 		func() {
@@ -322,7 +444,7 @@ func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
 				u.Path = cgi
 				u.RawQuery = ""
 				return u
-			}(*r.URL, os.Getenv("SCRIPT_NAME"))
+			}(*r.URL, script_name)
 			app.url = app.cgi
 			app.url.Path = path.Dir(app.cgi.Path)
 			if !strings.HasSuffix(app.url.Path, "/") {
@@ -347,6 +469,10 @@ func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
 			}
 		}
 
+		if err := app.PublishDueIfAny(now); err != nil {
+			log.Printf("couldn't publish scheduled posts: %s", err)
+		}
+
 		switch path_info {
 		case "/about":
 			http.Redirect(w, r, "about/", http.StatusFound)
@@ -370,6 +496,7 @@ func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
     <blog rdf:resource="https://demo.mro.name/shaarligo"/>
     <platform rdf:resource="https://httpd.apache.org/"/>
     <platform rdf:resource="https://www.lighttpd.net/"/>
+    <platform rdf:resource="https://nginx.org/"/>
     <platform rdf:resource="https://tools.ietf.org/html/rfc3875"/>
     <homepage rdf:resource="http://purl.mro.name/ShaarliGo"/>
     <wiki rdf:resource="https://code.mro.name/mro/ShaarliGo/wiki"/>
@@ -464,9 +591,24 @@ func handleMux(wg *sync.WaitGroup) http.HandlerFunc {
 		case "/search/":
 			app.handleSearch()(w, r)
 			return
+		case "/search/" + openSearchFileName:
+			app.handleOpenSearch()(w, r)
+			return
+		case "/" + uriTags + "/":
+			app.handleTagQuery()(w, r)
+			return
 		case "/tools/":
 			app.handleTools()(w, r)
 			return
+		case "/" + uriTrash + "/":
+			app.handleTrash()(w, r)
+			return
+		default:
+			// /history/<id>/
+			if parts := strings.Split(path_info, "/"); 4 == len(parts) && uriHistory == parts[1] && "" != parts[2] && "" == parts[3] {
+				app.handleHistory(Id(parts[2]))(w, r)
+				return
+			}
 		}
 		squealFailure(r, now, "404")
 		http.NotFound(w, r)
@@ -288,12 +288,20 @@ func (app *Server) handleDoPost(posse func(Entry)) http.HandlerFunc {
 						log.Println("todo: use returnurl ", returnurl)
 
 						// make persistent
+						unlock, err := lockFeedStorage(timeoutFeedLock)
+						if err != nil {
+							w.Header().Set("Retry-After", "10")
+							http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+							return
+						}
+						defer unlock()
 						feed, _ := LoadFeed()
 						feed.XmlBase = Iri(app.url.String())
 
 						lf_url := val("lf_url")
 						_, ent := feed.findEntryById(identifier)
-						if nil == ent {
+						isNew := nil == ent
+						if isNew {
 							ent = feed.newEntry(lf_linkdate)
 							if _, err := feed.Append(ent); err != nil {
 								http.Error(w, "couldn't add entry: "+err.Error(), http.StatusInternalServerError)
@@ -333,22 +341,56 @@ func (app *Server) handleDoPost(posse func(Entry)) http.HandlerFunc {
 							ent.Categories = a
 						}
 
+						// like shaarli, the mere presence counts
+						_, ent.Private = r.PostForm["lf_private"]
+						_, ent.Draft = r.PostForm["lf_draft"]
+						ent.PublishAt = nil
+						if v := val("lf_publish_at"); "" != v {
+							if t, err := time.ParseInLocation(fmtDateTimeLocal, v, app.tz); err != nil {
+								http.Error(w, "couldn't parse lf_publish_at: "+err.Error(), http.StatusBadRequest)
+								return
+							} else if t.After(now) {
+								// scheduled, see schedule.go
+								ent.Draft = true
+								p := iso8601(t)
+								ent.PublishAt = &p
+							}
+						}
+						if ent0.Draft && !ent.Draft {
+							ent.Published = iso8601(now)
+						}
+
 						if img := val("lf_image"); "" != img {
 							ent.MediaThumbnail = &MediaThumbnail{Url: Iri(img)}
 						}
+						// from <html lang> of the linked page, see entryFromNode. Keep it
+						// unless posted, clients may not know the field.
+						if _, ok := r.PostForm["lf_lang"]; ok || "" == ent.XmlLang {
+							if ent.XmlLang = normaliseLang(val("lf_lang")); "" == ent.XmlLang {
+								ent.XmlLang = detectLanguage(ds + " " + ex)
+							}
+						}
 
 						if err := ent.Validate(); err != nil {
 							http.Error(w, "couldn't add entry: "+err.Error(), http.StatusInternalServerError)
 							return
 						}
 
-						if err := app.SaveFeed(feed); err != nil {
+						if !isNew {
+							if err := saveRevision(ent0, *ent); err != nil {
+								http.Error(w, "couldn't store revision: "+err.Error(), http.StatusInternalServerError)
+								return
+							}
+						}
+						if err := app.SaveEntry(feed, ent); err != nil {
 							http.Error(w, "couldn't store feed data: "+err.Error(), http.StatusInternalServerError)
 							return
 						}
 						// todo: waiting group? fire and forget go function?
 						// we should, however, lock re-entrancy
-						posse(*ent)
+						if ent.isPublic() {
+							posse(*ent)
+						}
 						// refresh feeds
 						if err := app.PublishFeedsForModifiedEntries(feed, []*Entry{ent, &ent0}); err != nil {
 							log.Println("couldn't write feeds: ", err.Error())
@@ -363,9 +405,20 @@ func (app *Server) handleDoPost(posse func(Entry)) http.HandlerFunc {
 				token := val("token")
 				log.Println("todo: check token ", token)
 				// make persistent
+				unlock, err := lockFeedStorage(timeoutFeedLock)
+				if err != nil {
+					w.Header().Set("Retry-After", "10")
+					http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				defer unlock()
 				feed, _ := LoadFeed()
 				if ent := feed.deleteEntryById(identifier); nil != ent {
-					if err := app.SaveFeed(feed); err != nil {
+					if err := app.cfg.trashEntry(ent, now); err != nil {
+						http.Error(w, "couldn't move to trash: "+err.Error(), http.StatusInternalServerError)
+						return
+					}
+					if err := app.SaveDeletion(feed, ent.Id); err != nil {
 						http.Error(w, "couldn't store feed data: "+err.Error(), http.StatusInternalServerError)
 						return
 					}
@@ -478,6 +531,18 @@ func (entry Entry) api0LinkFormMap() map[string]interface{} {
 	if nil != entry.MediaThumbnail && len(entry.MediaThumbnail.Url) > 0 {
 		data["lf_image"] = entry.MediaThumbnail.Url
 	}
+	if "" != entry.XmlLang {
+		data["lf_lang"] = entry.XmlLang
+	}
+	if entry.Private {
+		data["lf_private"] = "on"
+	}
+	if entry.Draft {
+		data["lf_draft"] = "on"
+	}
+	if nil != entry.PublishAt && !entry.PublishAt.IsZero() {
+		data["lf_publish_at"] = entry.PublishAt.Format(fmtDateTimeLocal)
+	}
 
 	for key, value := range data {
 		if s, ok := value.(string); ok && !utf8.ValidString(s) {
@@ -181,6 +181,12 @@ func TestApi0LinkFormMap(t *testing.T) {
 		Categories: []Category{{Term: "Post"}, {Term: "tag1"}},
 	}
 	assert.Equal(t, map[string]interface{}{"lf_description": "#tag1", "lf_linkdate": "00010101_000000", "lf_tags": "Post tag1", "lf_title": "My #Post"}, e.api0LinkFormMap(), "oha")
+
+	e = Entry{Private: true}
+	assert.Equal(t, "on", e.api0LinkFormMap()["lf_private"], "oha")
+
+	e = Entry{XmlLang: "fr"}
+	assert.Equal(t, Lang("fr"), e.api0LinkFormMap()["lf_lang"], "oha")
 	// assert.Equal(t, map[string]string{"lf_linkdate": "00010101_000000", "lf_title": "My #Post", "lf_tags": "tag1"}, e.api0LinkFormMap(), "oha")
 }
 
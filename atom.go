@@ -74,26 +74,48 @@ type TextType string // https://tools.ietf.org/html/rfc4287#section-4.1.3.1
 //
 // see also https://godoc.org/golang.org/x/tools/blog/atom#Feed
 type Feed struct {
-	XMLName         xml.Name   `xml:"http://www.w3.org/2005/Atom feed"`
-	XmlBase         Iri        `xml:"xml:base,attr,omitempty"`
-	XmlLang         Lang       `xml:"xml:lang,attr,omitempty"`
-	XmlNSShaarliGo  string     `xml:"xmlns:sg,attr,omitempty"`         // https://github.com/golang/go/issues/9519#issuecomment-252196382
-	SearchTerms     string     `xml:"sg:searchTerms,attr,omitempty"`   // rather use http://www.opensearch.org/Specifications/OpenSearch/1.1#Example_of_OpenSearch_response_elements_in_Atom_1.0
-	XmlNSOpenSearch string     `xml:"xmlns:opensearch,attr,omitempty"` // https://github.com/golang/go/issues/9519#issuecomment-252196382
-	Query           string     `xml:"opensearch:Query,omitempty"`      // http://www.opensearch.org/Specifications/OpenSearch/1.1#Example_of_OpenSearch_response_elements_in_Atom_1.0
-	Title           HumanText  `xml:"title"`
-	Subtitle        *HumanText `xml:"subtitle,omitempty"`
-	Id              Id         `xml:"id"`
-	Updated         iso8601    `xml:"updated"`
-	Generator       *Generator `xml:"generator,omitempty"`
-	Icon            Iri        `xml:"icon,omitempty"`
-	Logo            Iri        `xml:"logo,omitempty"`
-	Links           []Link     `xml:"link"`
-	Categories      []Category `xml:"category"`
-	Authors         []Person   `xml:"author"`
-	Contributors    []Person   `xml:"contributor"`
-	Rights          *HumanText `xml:"rights,omitempty"`
-	Entries         []*Entry   `xml:"entry"`
+	XMLName         xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	XmlBase         Iri      `xml:"xml:base,attr,omitempty"`
+	XmlLang         Lang     `xml:"xml:lang,attr,omitempty"`
+	XmlNSShaarliGo  string   `xml:"xmlns:sg,attr,omitempty"`         // https://github.com/golang/go/issues/9519#issuecomment-252196382
+	SearchTerms     string   `xml:"sg:searchTerms,attr,omitempty"`   // rather use http://www.opensearch.org/Specifications/OpenSearch/1.1#Example_of_OpenSearch_response_elements_in_Atom_1.0
+	XmlNSOpenSearch string   `xml:"xmlns:opensearch,attr,omitempty"` // https://github.com/golang/go/issues/9519#issuecomment-252196382
+	Query           string   `xml:"opensearch:Query,omitempty"`      // http://www.opensearch.org/Specifications/OpenSearch/1.1#Example_of_OpenSearch_response_elements_in_Atom_1.0
+	TotalResults    *int     `xml:"opensearch:totalResults,omitempty"`
+	StartIndex      *int     `xml:"opensearch:startIndex,omitempty"` // counting from 0, see indexOffset in opensearch.go
+	ItemsPerPage    *int     `xml:"opensearch:itemsPerPage,omitempty"`
+
+	XmlNSFeedHistory string `xml:"xmlns:fh,attr,omitempty"` // https://tools.ietf.org/html/rfc5005
+	Complete         fhFlag `xml:"fh:complete,omitempty"`   // https://tools.ietf.org/html/rfc5005#section-2
+	Archive          fhFlag `xml:"fh:archive,omitempty"`    // https://tools.ietf.org/html/rfc5005#section-4
+
+	Title        HumanText  `xml:"title"`
+	Subtitle     *HumanText `xml:"subtitle,omitempty"`
+	Id           Id         `xml:"id"`
+	Updated      iso8601    `xml:"updated"`
+	Generator    *Generator `xml:"generator,omitempty"`
+	Icon         Iri        `xml:"icon,omitempty"`
+	Logo         Iri        `xml:"logo,omitempty"`
+	Links        []Link     `xml:"link"`
+	Categories   []Category `xml:"category"`
+	Authors      []Person   `xml:"author"`
+	Contributors []Person   `xml:"contributor"`
+	Rights       *HumanText `xml:"rights,omitempty"`
+	Entries      []*Entry   `xml:"entry"`
+	index        map[Id]int // Id -> offset into Entries, may be stale, see findEntryById
+}
+
+// empty marker element like <fh:complete/>, a plain bool to stay gob friendly
+type fhFlag bool
+
+func (v fhFlag) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if !v {
+		return nil
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
 }
 
 type Generator struct {
@@ -110,6 +132,15 @@ func (a iso8601) After(b iso8601) bool     { return time.Time(a).After(time.Time
 func (a iso8601) Before(b iso8601) bool    { return time.Time(a).Before(time.Time(b)) }
 func (a iso8601) Format(fmt string) string { return time.Time(a).Format(fmt) }
 
+// time.Time's gob methods don't carry over to the derived type.
+func (v iso8601) GobEncode() ([]byte, error) { return time.Time(v).GobEncode() }
+func (c *iso8601) GobDecode(data []byte) error {
+	t := time.Time{}
+	err := t.GobDecode(data)
+	*c = iso8601(t)
+	return err
+}
+
 func (v iso8601) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	e.EncodeElement(v.Format(time.RFC3339), start)
 	return nil
@@ -161,13 +192,22 @@ type Entry struct {
 	// Vorsicht! beim Schreiben (Marshal/Encode) fuchst's noch: https://github.com/golang/go/issues/9519#issuecomment-252196382
 	MediaThumbnail *MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail,omitempty"`
 	GeoRssPoint    *GeoRssPoint    `xml:"http://www.georss.org/georss point,omitempty"`
+	Private        bool            `xml:"http://purl.mro.name/ShaarliGo/ private,omitempty"` // logged-in only, lf_private
+	Draft          bool            `xml:"http://purl.mro.name/ShaarliGo/ draft,omitempty"`   // stored but not (yet) published, see schedule.go
+	PublishAt      *iso8601        `xml:"http://purl.mro.name/ShaarliGo/ publishAt,omitempty"`
+	pageLinks      []Link          // previous, next and up, only on the entry's own page, see PublishEntry
 }
 
 type HumanText struct {
-	XmlLang Lang     `xml:"xml:lang,attr,omitempty"`
-	Body    string   `xml:",chardata"`
-	Type    TextType `xml:"type,attr,omitempty"`
-	Src     Iri      `xml:"src,attr,omitempty"`
+	XmlLang Lang      `xml:"xml:lang,attr,omitempty"`
+	Body    string    `xml:",chardata"`
+	Type    TextType  `xml:"type,attr,omitempty"`
+	Src     Iri       `xml:"src,attr,omitempty"`
+	Div     *XhtmlDiv `xml:"http://www.w3.org/1999/xhtml div,omitempty"` // Type "xhtml" https://tools.ietf.org/html/rfc4287#section-3.1.1.3
+}
+
+type XhtmlDiv struct {
+	Body string `xml:",innerxml"` // well-formed xhtml markup
 }
 
 type Category struct {
@@ -241,6 +281,48 @@ func xmlEncodeWithXslt(e interface{}, hrefXslt string, enc *xml.Encoder) error {
 	return err
 }
 
+// deep enough copy to modify entries for publishing without touching the original.
+func (feed Feed) clone() Feed {
+	feed.Links = append([]Link(nil), feed.Links...)
+	feed.Categories = append([]Category(nil), feed.Categories...)
+	feed.Authors = append([]Person(nil), feed.Authors...)
+	feed.Contributors = append([]Person(nil), feed.Contributors...)
+	ents := make([]*Entry, 0, len(feed.Entries))
+	for _, ent := range feed.Entries {
+		ents = append(ents, ent.clone())
+	}
+	feed.Entries = ents
+	return feed
+}
+
+func (entry Entry) clone() *Entry {
+	entry.Links = append([]Link(nil), entry.Links...)
+	entry.Categories = append([]Category(nil), entry.Categories...)
+	entry.Authors = append([]Person(nil), entry.Authors...)
+	entry.Contributors = append([]Person(nil), entry.Contributors...)
+	if nil != entry.Summary {
+		s := *entry.Summary
+		entry.Summary = &s
+	}
+	if nil != entry.Content {
+		c := *entry.Content
+		entry.Content = &c
+	}
+	if nil != entry.MediaThumbnail {
+		m := *entry.MediaThumbnail
+		entry.MediaThumbnail = &m
+	}
+	if nil != entry.GeoRssPoint {
+		g := *entry.GeoRssPoint
+		entry.GeoRssPoint = &g
+	}
+	if nil != entry.PublishAt {
+		p := *entry.PublishAt
+		entry.PublishAt = &p
+	}
+	return &entry
+}
+
 func (feed *Feed) Append(e *Entry) (*Entry, error) {
 	if err := e.Validate(); err != nil {
 		return nil, err
@@ -332,6 +414,9 @@ func (feed *Feed) findEntry(doesMatch func(*Entry) bool) (int, *Entry) {
 
 func (feed *Feed) findEntryById(id Id) (int, *Entry) {
 	defer un(trace(strings.Join([]string{"Feed.findEntryById('", string(id), "')"}, "")))
+	if idx, ok := feed.index[id]; ok && idx < len(feed.Entries) && id == feed.Entries[idx].Id {
+		return idx, feed.Entries[idx]
+	}
 	if "" != id {
 		return feed.findEntry(func(entry *Entry) bool { return id == entry.Id })
 	}
@@ -0,0 +1,236 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rotating gzip copies of o.atom in app/var/old/, written before SaveFeed
+// replaces it. Retention see backup_keep_* in app/config.yaml.
+
+// UTC, mind windows not liking colons in file names. Microseconds, as restore
+// saves twice in a row.
+const fmtBackupTime = "20060102-150405.000000"
+
+var dirBackup string
+
+func init() {
+	dirBackup = filepath.Join(dirApp, "var", "old")
+}
+
+func backupFileName(t time.Time) string {
+	return filepath.Join(dirBackup, uriPub+".atom."+t.UTC().Format(fmtBackupTime)+".gz")
+}
+
+type backup struct {
+	file string
+	time time.Time
+}
+
+// newest first
+func listBackups() ([]backup, error) {
+	infos, err := ioutil.ReadDir(dirBackup)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []backup{}, nil
+		}
+		return nil, err
+	}
+	const prefix, suffix = uriPub + ".atom.", ".gz"
+	ret := make([]backup, 0, len(infos))
+	for _, fi := range infos {
+		name := fi.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		if t, err := time.Parse(fmtBackupTime, name[len(prefix):len(name)-len(suffix)]); err == nil {
+			ret = append(ret, backup{file: filepath.Join(dirBackup, name), time: t})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].time.After(ret[j].time) })
+	return ret, nil
+}
+
+// gzip a copy of src into app/var/old/
+func backupFeedStorage(src string, now time.Time) (string, error) {
+	defer un(trace("backupFeedStorage"))
+	r, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if err = os.MkdirAll(dirBackup, 0770); err != nil {
+		return "", err
+	}
+	dst := backupFileName(now)
+	for _, err := os.Stat(dst); err == nil; _, err = os.Stat(dst) {
+		now = now.Add(time.Microsecond) // don't overwrite one of the same instant
+		dst = backupFileName(now)
+	}
+	tmp := dst + "~"
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		gz := gzip.NewWriter(w)
+		if _, err = io.Copy(gz, r); err == nil {
+			if err = gz.Close(); err == nil {
+				if err = w.Close(); err == nil {
+					return dst, os.Rename(tmp, dst)
+				}
+			}
+		}
+	}
+	return "", err
+}
+
+// which backups (newest first) to remove. Keeps the keepLast newest plus the
+// newest of each of the keepDaily most recent days and the keepWeekly most
+// recent (ISO) weeks. Never removes the newest one.
+func backupsToPrune(all []backup, keepLast, keepDaily, keepWeekly int) []backup {
+	keep := make([]bool, len(all))
+	for i := 0; i < len(all) && i < max(1, keepLast); i++ {
+		keep[i] = true
+	}
+	keepNewestPer := func(n int, period func(time.Time) string) {
+		seen := make(map[string]bool, n)
+		for i, b := range all {
+			p := period(b.time)
+			if seen[p] {
+				continue
+			}
+			if len(seen) >= n {
+				break
+			}
+			seen[p] = true
+			keep[i] = true
+		}
+	}
+	keepNewestPer(keepDaily, func(t time.Time) string { return t.Format("2006-01-02") })
+	keepNewestPer(keepWeekly, func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-%d", y, w) })
+
+	ret := []backup{}
+	for i, b := range all {
+		if !keep[i] {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+func (cfg Config) rotateBackups(src string, now time.Time) error {
+	if _, err := backupFeedStorage(src, now); err != nil {
+		if os.IsNotExist(err) {
+			return nil // nothing to back up yet
+		}
+		return err
+	}
+	all, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for _, b := range backupsToPrune(all, cfg.BackupKeepLast, cfg.BackupKeepDaily, cfg.BackupKeepWeekly) {
+		if err := os.Remove(b.file); err != nil {
+			log.Printf("couldn't remove backup %s: %s", b.file, err)
+		}
+	}
+	return nil
+}
+
+func loadBackup(file string) (Feed, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Feed{}, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return Feed{}, err
+	}
+	defer gz.Close()
+	return FeedFromReader(gz)
+}
+
+// put back a backup and republish all feeds.
+//
+// $ shaarligo.cgi restore           # lists backups
+// $ shaarligo.cgi restore 20210304-050607.123456
+func restore(args []string) error {
+	all, err := listBackups()
+	if err != nil {
+		return err
+	}
+	if 1 != len(args) {
+		fmt.Printf("usage: %s restore <timestamp>\n\nbackups in %s:\n", filepath.Base(os.Args[0]), dirBackup)
+		for _, b := range all {
+			fmt.Printf("  %s\n", b.time.Format(fmtBackupTime))
+		}
+		return nil
+	}
+	file := ""
+	for _, b := range all {
+		if args[0] == b.time.Format(fmtBackupTime) {
+			file = b.file
+		}
+	}
+	if "" == file {
+		return fmt.Errorf("no backup '%s' in %s", args[0], dirBackup)
+	}
+
+	app, err := newCliServer()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFeedStorage(timeoutFeedLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	feed, err := loadBackup(file)
+	if err != nil {
+		return err
+	}
+	old, err := LoadFeed()
+	if err == nil {
+		// compact the journal, so the current state gets backed up completely
+		if err = app.SaveFeed(old); err != nil {
+			return err
+		}
+	}
+	if err = app.SaveFeed(feed); err != nil { // backs up the current state, too
+		return err
+	}
+	// republish posts gone or back
+	modified := append(append([]*Entry{}, feed.Entries...), old.Entries...)
+	feed.XmlBase = Iri(app.url.String())
+	if err = app.PublishFeedsForModifiedEntries(feed, modified); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s with %d posts\n", args[0], len(feed.Entries))
+	return nil
+}
@@ -0,0 +1,90 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBackupsToPrune(t *testing.T) {
+	t.Parallel()
+	t0 := mustParseRFC3339("2021-03-04T05:06:07Z") // a thursday
+	all := []backup{}
+	for i := 0; i < 40; i++ {
+		// two per day, newest first
+		all = append(all, backup{file: string(rune('a' + i)), time: t0.Add(-time.Duration(i) * 12 * time.Hour)})
+	}
+	prune := backupsToPrune(all, 3, 2, 2)
+	keep := map[string]bool{}
+	for _, b := range all {
+		keep[b.file] = true
+	}
+	for _, b := range prune {
+		delete(keep, b.file)
+	}
+	// last 3: a b c, daily: a (thu) b (wed), weekly: a (this week) h (previous sunday)
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "c": true, "h": true}, keep, "aha")
+
+	assert.Equal(t, 0, len(backupsToPrune(all[:1], 0, 0, 0)), "never the newest")
+}
+
+func TestRotateBackups(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	cfg := Config{BackupKeepLast: 2}
+
+	assert.Nil(t, cfg.rotateBackups(fileFeedStorage, time.Now()), "nothing to back up")
+	all, _ := listBackups()
+	assert.Equal(t, 0, len(all), "aha")
+
+	feed := Feed{Title: HumanText{Body: "A"}}
+	assert.Nil(t, feed.SaveToFile(fileFeedStorage), "aha")
+	t0 := mustParseRFC3339("2021-03-04T05:06:07Z")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, cfg.rotateBackups(fileFeedStorage, t0.Add(time.Duration(i)*time.Minute)), "aha")
+	}
+	all, err := listBackups()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 2, len(all), "aha")
+	assert.Equal(t, filepath.Join(dirApp, "var", "old", "o.atom.20210304-050907.000000.gz"), all[0].file, "aha")
+
+	f, err := loadBackup(all[1].file)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "A", f.Title.Body, "aha")
+}
+
+func TestBackupSameInstant(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	feed := Feed{Title: HumanText{Body: "A"}}
+	assert.Nil(t, feed.SaveToFile(fileFeedStorage), "aha")
+	t0 := mustParseRFC3339("2021-03-04T05:06:07Z")
+	a, err := backupFeedStorage(fileFeedStorage, t0)
+	assert.Nil(t, err, "aha")
+	b, err := backupFeedStorage(fileFeedStorage, t0)
+	assert.Nil(t, err, "aha")
+	assert.NotEqual(t, a, b, "don't overwrite")
+	all, _ := listBackups()
+	assert.Equal(t, 2, len(all), "aha")
+	assert.Equal(t, "20210304-050607.000001", all[0].time.Format(fmtBackupTime), "aha")
+}
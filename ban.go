@@ -52,18 +52,30 @@ func remoteAddressToKey(addr string) string {
 
 func isBanned(r *http.Request, now time.Time) (bool, error) {
 	key := remoteAddressToKey(r.RemoteAddr)
-	if data, err := ioutil.ReadFile(banFileName); err == nil || os.IsNotExist(err) {
-		bans := BanPenalties{}
-		if err := yaml.Unmarshal(data, &bans); err == nil {
-			return bans.isRemoteAddrBanned(key, now), nil
-		} else {
+	if nil != memCache {
+		if v, err := memCache.load(banFileName, func(file string) (interface{}, error) { return loadBans(file) }); err == nil {
+			return v.(BanPenalties).isRemoteAddrBanned(key, now), nil
+		} else if !os.IsNotExist(err) {
 			return true, err
 		}
+		return false, nil
+	}
+	if bans, err := loadBans(banFileName); err == nil || os.IsNotExist(err) {
+		return bans.isRemoteAddrBanned(key, now), nil
 	} else {
 		return true, err
 	}
 }
 
+func loadBans(file string) (BanPenalties, error) {
+	bans := BanPenalties{}
+	if data, err := ioutil.ReadFile(file); err != nil {
+		return bans, err
+	} else {
+		return bans, yaml.Unmarshal(data, &bans)
+	}
+}
+
 func squealFailure(r *http.Request, now time.Time, reason string) error {
 	key := remoteAddressToKey(r.RemoteAddr)
 	var err error
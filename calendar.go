@@ -0,0 +1,60 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// o/d/index.json, the number of posts per day to browse the archive, e.g.
+// {"2021-01-01":2,"2021-01-03":1}
+
+const calendarFileName = "index.json"
+
+func calendar(entries []*Entry) map[string]int {
+	ret := make(map[string]int, len(entries))
+	for _, ent := range entries {
+		ret[ent.Published.Format(time.RFC3339[:10])]++
+	}
+	return ret
+}
+
+// write o/d/index.json for the given (public) entries.
+func publishCalendar(entries []*Entry) error {
+	dstDirName := filepath.FromSlash(uriPubDays)
+	dst := filepath.Join(dstDirName, calendarFileName)
+	tmp := dst + "~"
+	var err error
+	if err = os.MkdirAll(dstDirName, newDirPerms); err == nil {
+		var w *os.File
+		if w, err = os.Create(tmp); err == nil {
+			defer w.Close() // just to be sure
+			if err = json.NewEncoder(w).Encode(calendar(entries)); err == nil {
+				if err = w.Close(); err == nil {
+					if err = os.Rename(tmp, dst); err == nil {
+						return gzipSibling(dst, time.Now())
+					}
+				}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCalendar(t *testing.T) {
+	t.Parallel()
+	day := func(d int) iso8601 { return iso8601(time.Date(2021, 1, d, 12, 0, 0, 0, time.UTC)) }
+	cal := calendar([]*Entry{{Published: day(3)}, {Published: day(1)}, {Published: day(1)}})
+	assert.Equal(t, map[string]int{"2021-01-01": 2, "2021-01-03": 1}, cal, "aha")
+	assert.Equal(t, map[string]int{}, calendar(nil), "aha")
+}
+
+func TestPublishCalendar(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	for i, id := range []Id{"a", "b", "c"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: string(id)}, Published: iso8601(time.Date(2021, time.Month(1+i/2), 1, 0, 0, 0, 0, time.UTC))})
+		assert.Nil(t, err, "aha")
+	}
+	_, err := feed.Append(&Entry{Id: "d", Private: true, Published: iso8601(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))})
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	b, err := ioutil.ReadFile(filepath.Join("o", "d", "index.json"))
+	assert.Nil(t, err, "aha")
+	cal := map[string]int{}
+	assert.Nil(t, json.Unmarshal(b, &cal), "aha")
+	assert.Equal(t, map[string]int{"2021-01-01": 2, "2021-02-01": 1}, cal, "without private")
+
+	for _, dir := range []string{"2021-01-01", "2021-01", "2021-02", "2021"} {
+		_, err = os.Stat(filepath.Join("o", "d", dir, "index.xml"))
+		assert.Nil(t, err, dir)
+	}
+	_, err = os.Stat(filepath.Join("o", "d", "2021-03"))
+	assert.True(t, os.IsNotExist(err), "private only")
+}
@@ -60,12 +60,17 @@ type Config struct {
 	PwdBcrypt         string                   `yaml:"pwd_bcrypt"`
 	CookieStoreSecret string                   `yaml:"cookie_secret"`
 	TimeZone          string                   `yaml:"timezone"`
+	Language          string                   `yaml:"language"`       // search matching if posts have none, see lang.go
 	LinksPerPage      int                      `yaml:"links_per_page"` // https://github.com/sebsauvage/Shaarli/blob/master/index.php#L18
 	BanAfter          int                      `yaml:"ban_after"`      // https://github.com/sebsauvage/Shaarli/blob/master/index.php#L20
 	BanSeconds        int                      `yaml:"ban_seconds"`    // https://github.com/sebsauvage/Shaarli/blob/master/index.php#L21
 	UrlCleaner        []RegexpReplaceAllString `yaml:"url_cleaner"`
 	Posse_            []map[string]string      `yaml:"posse"`
 	Posse             []interface{}            `yaml:"-"`
+	BackupKeepLast    int                      `yaml:"backup_keep_last"` // app/var/old/, see backup.go
+	BackupKeepDaily   int                      `yaml:"backup_keep_daily"`
+	BackupKeepWeekly  int                      `yaml:"backup_keep_weekly"`
+	TrashPurgeDays    int                      `yaml:"trash_purge_days"` // see trash.go
 	// Redirector     string                   `yaml:"redirector"` // actually a prefix to href - Hardcoded in xslt
 }
 
@@ -84,6 +89,18 @@ func loadConfi(dat []byte) (Config, error) {
 	ret.LinksPerPage = max(1, ret.LinksPerPage)
 	ret.BanAfter = max(1, ret.BanAfter)
 	ret.BanSeconds = max(1, ret.BanSeconds)
+	if 0 == ret.BackupKeepLast {
+		ret.BackupKeepLast = 10
+	}
+	if 0 == ret.BackupKeepDaily {
+		ret.BackupKeepDaily = 7
+	}
+	if 0 == ret.BackupKeepWeekly {
+		ret.BackupKeepWeekly = 4
+	}
+	if 0 == ret.TrashPurgeDays {
+		ret.TrashPurgeDays = 30
+	}
 	// a hack to get a polymoprhic list.
 	for _, m := range ret.Posse_ {
 		if pi, ok := m["pinboard"]; ok {
@@ -105,7 +122,18 @@ func loadConfi(dat []byte) (Config, error) {
 }
 
 func LoadConfig() (Config, error) {
-	if read, err := ioutil.ReadFile(configFileName); err != nil {
+	if nil != memCache {
+		if v, err := memCache.load(configFileName, func(file string) (interface{}, error) { return loadConfigFile(file) }); err != nil {
+			return Config{}, err
+		} else {
+			return v.(Config), nil
+		}
+	}
+	return loadConfigFile(configFileName)
+}
+
+func loadConfigFile(file string) (Config, error) {
+	if read, err := ioutil.ReadFile(file); err != nil {
 		return Config{}, err
 	} else {
 		return loadConfi(read)
@@ -73,6 +73,13 @@ func (app *Server) handleSettings() http.HandlerFunc {
 				err = app.cfg.Save()
 			}
 
+			unlock, err := lockFeedStorage(timeoutFeedLock)
+			if err != nil {
+				w.Header().Set("Retry-After", "10")
+				http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			defer unlock()
 			if feed, err := LoadFeed(); err != nil {
 				http.Error(w, "couldn't load seed feed feeds: "+err.Error(), http.StatusInternalServerError)
 				return
@@ -0,0 +1,206 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Shaarli-style daily digest, one entry per day summarising all its posts at
+// o/daily/<day>/ and the most recent days as a feed at o/daily/
+
+const uriDaily = "daily"
+const uriPubDaily = uriPub + "/" + uriDaily + "/"
+
+// xhtml, so it's well-formed and can be copied into the page by posts.xslt.
+var tplDailyDigest = template.Must(template.New("daily").Parse(`{{range .}}
+<div class="daily-post">
+  <h4>{{with .Thumbnail}}<img alt="" src="{{.}}" /> {{end}}<a href="{{.Url}}">{{.Title}}</a> <a href="{{.Permalink}}" title="Permalink">∞</a></h4>
+  {{with .Text}}<p>{{.}}</p>{{end}}
+  {{with .Tags}}<p class="categories">{{range .}}<a href="{{.Href}}" class="tag">#{{.Term}}</a> {{end}}</p>{{end}}
+</div>{{end}}
+`))
+
+type dailyPost struct {
+	Title     string
+	Url       string
+	Permalink string
+	Thumbnail string
+	Text      string
+	Tags      []dailyTag
+}
+
+type dailyTag struct {
+	Term string
+	Href string
+}
+
+// the digests to publish, computed before PagedFeeds modifies the entries.
+type dailyDigests struct {
+	feed Feed              // o/daily/ with the most recent days
+	days map[string]*Entry // the affected days, nil if gone
+}
+
+// group public entries by day of publication, newest day first.
+func entriesByDay(entries []*Entry) ([]string, map[string][]*Entry) {
+	days := make([]string, 0, len(entries))
+	byDay := make(map[string][]*Entry, len(entries))
+	for _, ent := range publicEntries(entries) {
+		day := ent.Published.Format(time.RFC3339[:10])
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], ent)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days, byDay
+}
+
+// one entry summarising the posts of one day.
+func (seed Feed) dailyDigest(day string, entries []*Entry) (*Entry, error) {
+	base := string(seed.XmlBase)
+	uri := uriPubDaily + day + "/"
+	ret := &Entry{
+		XmlBase: seed.XmlBase,
+		Title:   HumanText{Body: "📅 Daily " + day},
+		Id:      Id(base + uri),
+		Links: []Link{
+			{Rel: relSelf, Href: uri},
+			{Rel: relUp, Href: uriPubPosts, Title: seed.Title.Body}, // we need the feed-name somewhere.
+			{Rel: relUp, Href: uriPubDaily, Title: "📅 Daily"},
+			{Rel: relUp, Href: uriPubDays + day + "/", Title: day},
+		},
+	}
+	posts := make([]dailyPost, 0, len(entries))
+	terms := make(map[string]bool, 2*len(entries))
+	for _, ent := range entries {
+		updated := ent.Updated
+		if updated.IsZero() {
+			updated = ent.Published
+		}
+		if ret.Updated.Before(updated) {
+			ret.Updated = updated
+		}
+		if ret.Published.Before(ent.Published) {
+			ret.Published = ent.Published
+		}
+		post := dailyPost{
+			Title:     ent.Title.Body,
+			Permalink: base + path.Join(uriPub, uriPosts, string(ent.Id)) + "/",
+		}
+		post.Url = post.Permalink
+		for _, l := range ent.Links {
+			if "" == l.Rel {
+				post.Url = l.Href
+				break
+			}
+		}
+		if nil != ent.Content {
+			post.Text = ent.Content.Body
+		}
+		if nil != ent.MediaThumbnail {
+			post.Thumbnail = string(ent.MediaThumbnail.Url)
+			if nil == ret.MediaThumbnail {
+				ret.MediaThumbnail = &MediaThumbnail{Url: ent.MediaThumbnail.Url}
+			}
+		}
+		for _, cat := range ent.Categories {
+			post.Tags = append(post.Tags, dailyTag{Term: cat.Term, Href: base + uriPubTags + cat.Term + "/"})
+			if !terms[cat.Term] {
+				terms[cat.Term] = true
+				ret.Categories = append(ret.Categories, Category{Term: cat.Term, Scheme: Iri(base + uriPubTags)})
+			}
+		}
+		posts = append(posts, post)
+	}
+	var buf bytes.Buffer
+	if err := tplDailyDigest.Execute(&buf, posts); err != nil {
+		return nil, err
+	}
+	ret.Content = &HumanText{Type: "xhtml", Div: &XhtmlDiv{Body: buf.String()}}
+	return ret, nil
+}
+
+// the digests of the days of the modified entries plus the o/daily/ feed.
+func (seed Feed) DailyDigests(modified []*Entry, daysPerPage int) (dailyDigests, error) {
+	days, byDay := entriesByDay(seed.Entries)
+	ret := dailyDigests{days: make(map[string]*Entry, len(modified))}
+	var err error
+	for _, ent := range modified {
+		day := ent.Published.Format(time.RFC3339[:10])
+		if _, ok := ret.days[day]; ok {
+			continue
+		}
+		var digest *Entry // nil if no posts left that day
+		if entries := byDay[day]; len(entries) > 0 {
+			if digest, err = seed.dailyDigest(day, entries); err != nil {
+				return ret, err
+			}
+		}
+		ret.days[day] = digest
+	}
+
+	ret.feed = seed // clone
+	ret.feed.Id = Id(uriPubDaily)
+	ret.feed.Subtitle = &HumanText{Body: "📅 Daily"}
+	ret.feed.Categories = nil
+	ret.feed.Updated = iso8601(time.Time{})
+	ret.feed.Links = append(append(make([]Link, 0, len(seed.Links)+1), seed.Links...), Link{Rel: relSelf, Href: uriPubDaily})
+	ret.feed.Entries = make([]*Entry, 0, daysPerPage)
+	for _, day := range days {
+		if len(ret.feed.Entries) >= max(1, daysPerPage) {
+			break
+		}
+		digest := ret.days[day]
+		if nil == digest {
+			if digest, err = seed.dailyDigest(day, byDay[day]); err != nil {
+				return ret, err
+			}
+		}
+		if ret.feed.Updated.Before(digest.Updated) {
+			ret.feed.Updated = digest.Updated
+		}
+		ret.feed.Entries = append(ret.feed.Entries, digest)
+	}
+	return ret, nil
+}
+
+// write o/daily/<day>/index.xml for the affected days and the o/daily/ feed.
+func (app Server) PublishDaily(dd dailyDigests) error {
+	defer un(trace("App.PublishDaily"))
+	for day, digest := range dd.days {
+		if nil == digest {
+			dstDirName := filepath.FromSlash(uriPubDaily + day + "/")
+			if err := removeWithGzipSibling(filepath.Join(dstDirName, "index.xml")); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			os.Remove(dstDirName)
+			continue
+		}
+		if err := app.PublishEntry(digest, true); err != nil {
+			return err
+		}
+	}
+	return app.PublishFeed(dd.feed, true)
+}
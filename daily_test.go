@@ -0,0 +1,128 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEntriesByDay(t *testing.T) {
+	t.Parallel()
+	day := func(d int) iso8601 { return iso8601(time.Date(2021, 1, d, 12, 0, 0, 0, time.UTC)) }
+	a, b, c := &Entry{Id: "a", Published: day(1)}, &Entry{Id: "b", Published: day(3)}, &Entry{Id: "c", Published: day(1)}
+	days, byDay := entriesByDay([]*Entry{a, b, c, {Id: "d", Private: true, Published: day(2)}})
+	assert.Equal(t, []string{"2021-01-03", "2021-01-01"}, days, "newest first, without private")
+	assert.Equal(t, []*Entry{a, c}, byDay["2021-01-01"], "aha")
+}
+
+func TestDailyDigest(t *testing.T) {
+	t.Parallel()
+	seed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "My Links"}}
+	entries := []*Entry{
+		{
+			Id:             "b",
+			Title:          HumanText{Body: "B & Co"},
+			Published:      iso8601(mustParseRFC3339("2021-01-01T13:00:00Z")),
+			Links:          []Link{{Href: "http://example.org/b"}},
+			Content:        &HumanText{Body: "<b>not bold</b>"},
+			Categories:     []Category{{Term: "foo"}, {Term: "bar"}},
+			MediaThumbnail: &MediaThumbnail{Url: "http://example.org/b.jpg"},
+		},
+		{
+			Id:         "a",
+			Title:      HumanText{Body: "A"},
+			Published:  iso8601(mustParseRFC3339("2021-01-01T12:00:00Z")),
+			Updated:    iso8601(mustParseRFC3339("2021-01-02T12:00:00Z")),
+			Categories: []Category{{Term: "foo"}},
+		},
+	}
+	ent, err := seed.dailyDigest("2021-01-01", entries)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, Id("http://example.com/o/daily/2021-01-01/"), ent.Id, "aha")
+	assert.Equal(t, "o/daily/2021-01-01/", LinkRelSelf(ent.Links).Href, "aha")
+	assert.Equal(t, "2021-01-01T13:00:00Z", ent.Published.Format(time.RFC3339), "newest post")
+	assert.Equal(t, "2021-01-02T12:00:00Z", ent.Updated.Format(time.RFC3339), "latest change")
+	assert.Equal(t, []Category{{Term: "foo", Scheme: "http://example.com/o/t/"}, {Term: "bar", Scheme: "http://example.com/o/t/"}}, ent.Categories, "aha")
+	assert.Equal(t, Iri("http://example.org/b.jpg"), ent.MediaThumbnail.Url, "aha")
+	assert.Equal(t, TextType("xhtml"), ent.Content.Type, "aha")
+
+	div := ent.Content.Div.Body
+	assert.Contains(t, div, `<a href="http://example.org/b">B &amp; Co</a>`, "aha")
+	assert.Contains(t, div, `<a href="http://example.com/o/p/b/" title="Permalink">`, "aha")
+	assert.Contains(t, div, `<a href="http://example.com/o/p/a/">A</a>`, "no link, just the permalink")
+	assert.Contains(t, div, `&lt;b&gt;not bold&lt;/b&gt;`, "aha")
+	assert.Contains(t, div, `<a href="http://example.com/o/t/bar/" class="tag">#bar</a>`, "aha")
+	assert.Contains(t, div, `<img alt="" src="http://example.org/b.jpg" />`, "decorative, next to the title")
+
+	// well-formed xhtml inside the atom content
+	buf, err := xml.Marshal(ent)
+	assert.Nil(t, err, "aha")
+	assert.Contains(t, string(buf), `<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">`, "aha")
+	back := Entry{}
+	assert.Nil(t, xml.Unmarshal(buf, &back), "aha")
+	assert.Equal(t, div, back.Content.Div.Body, "aha")
+}
+
+func TestPublishDaily(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 1}}
+	mk := func() Feed {
+		feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+		for i, id := range []Id{"a", "b", "c"} {
+			_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: string(id)}, Published: iso8601(time.Date(2021, 1, 1+i/2, 12, i, 0, 0, time.UTC))})
+			assert.Nil(t, err, "aha")
+		}
+		return feed
+	}
+	feed := mk()
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	load := func(file string, v interface{}) {
+		b, err := ioutil.ReadFile(filepath.FromSlash(file))
+		assert.Nil(t, err, file)
+		assert.Nil(t, xml.Unmarshal(b, v), file)
+	}
+	ent := Entry{}
+	load("o/daily/2021-01-01/index.xml", &ent)
+	assert.Equal(t, Id("http://example.com/o/daily/2021-01-01/"), ent.Id, "aha")
+	assert.Contains(t, ent.Content.Div.Body, "http://example.com/o/p/b/", "aha")
+	_, err := os.Stat(filepath.FromSlash("o/daily/2021-01-02/index.xml.gz"))
+	assert.Nil(t, err, "aha")
+
+	daily := Feed{}
+	load("o/daily/index.xml", &daily)
+	assert.Equal(t, 1, len(daily.Entries), "LinksPerPage days")
+	assert.Equal(t, Id("http://example.com/o/daily/2021-01-02/"), daily.Entries[0].Id, "newest day")
+
+	// deleting the only post of a day removes its digest
+	feed = mk()
+	c := feed.deleteEntryById("c")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, []*Entry{c}), "aha")
+	_, err = os.Stat(filepath.FromSlash("o/daily/2021-01-02"))
+	assert.True(t, os.IsNotExist(err), "aha")
+	daily = Feed{}
+	load("o/daily/index.xml", &daily)
+	assert.Equal(t, Id("http://example.com/o/daily/2021-01-01/"), daily.Entries[0].Id, "aha")
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"os"
+	"strings"
+	"sync"
+)
+
+// FastCGI e.g. for nginx, see static/app/99-nginx-shaarligo.conf
+
+// spawn-fcgi, systemd socket activation & co. hand over the listening socket as
+// stdin. Mind apache mod_cgid connecting plain CGIs via a socket, too.
+func isSpawnedFastCGI() bool {
+	if 0 != len(os.Getenv("REQUEST_METHOD")) {
+		return false
+	}
+	fi, err := os.Stdin.Stat()
+	return err == nil && 0 != fi.Mode()&os.ModeSocket
+}
+
+// $ shaarligo.cgi fcgi -listen unix:/run/shaarligo/fcgi.sock
+func serveFastCGI(args []string) error {
+	flags := flag.NewFlagSet("fcgi", flag.ContinueOnError)
+	listen := flags.String("listen", "", "tcp address (127.0.0.1:9000) or unix socket (unix:/run/shaarligo/fcgi.sock) to listen at, stdin if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var l net.Listener // nil means stdin
+	if "" != *listen {
+		network, address := "tcp", *listen
+		if strings.HasPrefix(address, "unix:") {
+			network, address = "unix", strings.TrimPrefix(address, "unix:")
+			os.Remove(address) // stale from a previous run
+		}
+		var err error
+		if l, err = net.Listen(network, address); err != nil {
+			return err
+		}
+		defer l.Close()
+		log.Printf("listening at %s", *listen)
+	}
+	return serveFastCGIListener(l)
+}
+
+func serveFastCGIListener(l net.Listener) error {
+	memCache = newFileCache()
+	wg := &sync.WaitGroup{}
+	err := fcgi.Serve(l, handleFastCGI(wg))
+	wg.Wait()
+	return err
+}
+
+// SCRIPT_NAME and PATH_INFO as sent by the webserver, if fcgi.ProcessEnv has
+// them. Current net/http/fcgi consumes both building r.URL and leaves them out,
+// so then fall back to splitScriptName.
+func fcgiScriptName(r *http.Request) (scriptName, pathInfo string, ok bool) {
+	env := fcgi.ProcessEnv(r)
+	if s := env["SCRIPT_NAME"]; "" != s {
+		if p, found := env["PATH_INFO"]; found {
+			return s, p, true
+		}
+		if strings.HasPrefix(r.URL.Path, s) {
+			return s, r.URL.Path[len(s):], true
+		}
+	}
+	return splitScriptName(r.URL.Path)
+}
+
+// split the request path at the cgi name.
+func splitScriptName(p string) (scriptName, pathInfo string, ok bool) {
+	const script = "/" + cgiName
+	for idx := 0; idx < len(p); {
+		i := strings.Index(p[idx:], script)
+		if i < 0 {
+			break
+		}
+		end := idx + i + len(script)
+		if end == len(p) || '/' == p[end] {
+			return p[:end], p[end:], true
+		}
+		idx = end
+	}
+	return "", "", false
+}
+
+func handleFastCGI(wg *sync.WaitGroup) http.Handler {
+	cgi := handleMux(wg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if script, pathInfo, ok := fcgiScriptName(r); ok {
+			env := cgiEnv{ScriptName: script, PathInfo: pathInfo}
+			cgi(w, r.WithContext(context.WithValue(r.Context(), cgiEnvKey{}, env)))
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
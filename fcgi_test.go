@@ -0,0 +1,126 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplitScriptName(t *testing.T) {
+	t.Parallel()
+	s, p, ok := splitScriptName("/sub/shaarligo.cgi/search/")
+	assert.True(t, ok, "aha")
+	assert.Equal(t, "/sub/shaarligo.cgi", s, "aha")
+	assert.Equal(t, "/search/", p, "aha")
+
+	s, p, ok = splitScriptName("/shaarligo.cgi")
+	assert.True(t, ok, "aha")
+	assert.Equal(t, "/shaarligo.cgi", s, "aha")
+	assert.Equal(t, "", p, "aha")
+
+	s, p, ok = splitScriptName("/shaarligo.cgix/shaarligo.cgi/about")
+	assert.True(t, ok, "aha")
+	assert.Equal(t, "/shaarligo.cgix/shaarligo.cgi", s, "aha")
+	assert.Equal(t, "/about", p, "aha")
+
+	_, _, ok = splitScriptName("/o/p/")
+	assert.False(t, ok, "aha")
+}
+
+func TestHandleFastCGI(t *testing.T) {
+	defer prepTeardown(t)()
+
+	h := handleFastCGI(&sync.WaitGroup{})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/about/", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	assert.Equal(t, "text/xml; charset=utf-8", w.Header().Get("Content-Type"), "aha")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/o/p/", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "aha")
+}
+
+// a minimal FastCGI responder request like nginx sends it.
+func fcgiGet(t *testing.T, addr string, params map[string]string) string {
+	c, err := net.Dial("tcp", addr)
+	assert.Nil(t, err, "aha")
+	defer c.Close()
+	record := func(typ uint8, body []byte) {
+		hdr := []byte{1, typ, 0, 1, 0, 0, 0, 0}
+		binary.BigEndian.PutUint16(hdr[4:], uint16(len(body)))
+		c.Write(append(hdr, body...))
+	}
+	record(1, []byte{0, 1, 0, 0, 0, 0, 0, 0}) // begin, responder
+	kv := []byte{}
+	for k, v := range params {
+		kv = append(append(append(kv, byte(len(k)), byte(len(v))), k...), v...)
+	}
+	record(4, kv)
+	record(4, nil)
+	record(5, nil)
+
+	out := bytes.Buffer{}
+	hdr := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(c, hdr); err != nil {
+			break
+		}
+		body := make([]byte, int(binary.BigEndian.Uint16(hdr[4:]))+int(hdr[6]))
+		if _, err := io.ReadFull(c, body); err != nil {
+			break
+		}
+		if 6 == hdr[1] { // stdout
+			out.Write(body[:len(body)-int(hdr[6])])
+		}
+		if 3 == hdr[1] { // end
+			break
+		}
+	}
+	return out.String()
+}
+
+func TestServeFastCGI(t *testing.T) {
+	defer prepTeardown(t)()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err, "aha")
+	defer l.Close()
+	go fcgi.Serve(l, handleFastCGI(&sync.WaitGroup{}))
+
+	out := fcgiGet(t, l.Addr().String(), map[string]string{
+		"REQUEST_METHOD":  "GET",
+		"SCRIPT_NAME":     "/sub/shaarligo.cgi",
+		"PATH_INFO":       "/about/",
+		"REQUEST_URI":     "/sub/shaarligo.cgi/about/",
+		"SERVER_PROTOCOL": "HTTP/1.1",
+		"HTTP_HOST":       "example.com",
+	})
+	assert.Contains(t, out, "Content-Type: text/xml; charset=utf-8", "aha")
+	assert.NotContains(t, out, "Status: 404", "aha")
+}
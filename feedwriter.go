@@ -22,7 +22,6 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
@@ -65,6 +64,14 @@ const relEditMedia = Relation("edit-media") // AtomPub https://tools.ietf.org/ht
 const relUp = Relation("up")                // https://www.iana.org/assignments/link-relations/link-relations.xhtml
 const relSearch = Relation("search")        // http://www.opensearch.org/Specifications/OpenSearch/1.1#Autodiscovery_in_RSS.2FAtom
 
+const relVersionHistory = Relation("version-history") // https://tools.ietf.org/html/rfc5829
+
+const relCurrent = Relation("current")          // archived feeds https://tools.ietf.org/html/rfc5005#section-4
+const relPrevArchive = Relation("prev-archive") // archived feeds https://tools.ietf.org/html/rfc5005#section-4
+const relNextArchive = Relation("next-archive") // archived feeds https://tools.ietf.org/html/rfc5005#section-4
+
+const fhNamespace = "http://purl.org/syndication/history/1.0"
+
 const newDirPerms = 0775
 
 var rexPath = regexp.MustCompile("[^/]+")
@@ -110,6 +117,13 @@ func (entry Entry) FeedFilters(uri2filter map[string]func(*Entry) bool) map[stri
 	uri2filter[uriPubDays+dayStr+"/"] = func(iEntry *Entry) bool {
 		return dayStr == iEntry.Published.Format(time.RFC3339[:10])
 	}
+	// aggregated per month and year
+	for _, prefix := range []string{dayStr[:len("2006-01")], dayStr[:len("2006")]} {
+		prefix := prefix
+		uri2filter[uriPubDays+prefix+"/"] = func(iEntry *Entry) bool {
+			return strings.HasPrefix(iEntry.Published.Format(time.RFC3339[:10]), prefix)
+		}
+	}
 
 	return uri2filter
 }
@@ -142,11 +156,49 @@ func uriSliceSorted(uri2filter map[string]func(*Entry) bool) []string {
 	return keys
 }
 
-// collect all entries into all (unpaged, complete) feeds to publish.
+// what goes into the static o/ tree.
+func (entry *Entry) isPublic() bool {
+	return !entry.Private && !entry.Draft
+}
+
+func publicEntries(entries []*Entry) []*Entry {
+	ret := make([]*Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.isPublic() {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// the public chronological neighbours of the modified entries, as their
+// previous/next links change. pub must be sorted ByPublishedDesc.
+func neighbourEntries(pub []*Entry, modified []*Entry) map[*Entry]bool {
+	ret := make(map[*Entry]bool, 2*len(modified))
+	for _, mod := range modified {
+		idx := sort.Search(len(pub), func(i int) bool { return !pub[i].Published.After(mod.Published) })
+		for i := idx - 1; i >= 0; i-- { // newer
+			if pub[i].Id != mod.Id {
+				ret[pub[i]] = true
+				break
+			}
+		}
+		for i := idx; i < len(pub); i++ { // older
+			if pub[i].Id != mod.Id {
+				ret[pub[i]] = true
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// collect all public entries into all (unpaged, complete) feeds to publish.
 //
 // return sorted by Id
 func (seed Feed) CompleteFeeds(uri2filter map[string]func(*Entry) bool) []Feed {
 	defer un(trace("Feed.CompleteFeeds"))
+	seed.Entries = publicEntries(seed.Entries)
 	ret := make([]Feed, 0, len(uri2filter))
 	for _, uri := range uriSliceSorted(uri2filter) {
 		entryFilter := uri2filter[uri]
@@ -161,6 +213,8 @@ func (seed Feed) CompleteFeeds(uri2filter map[string]func(*Entry) bool) []Feed {
 		}
 		if uriPubTags == uri {
 			feed.Categories = AggregateCategories(seed.Entries) // rather the ones from o/p
+		} else if strings.HasPrefix(uri, uriPubTags) {
+			feed.Categories = relatedCategories(feed.Entries, strings.TrimSuffix(uri[len(uriPubTags):], "/"))
 		}
 		ret = append(ret, feed)
 	}
@@ -174,9 +228,22 @@ func appendPageNumber(prefix string, page, pageCount int) string {
 	if page == pageCount-1 {
 		return prefix
 	}
+	if isAggregateDaysUri(prefix) {
+		// a suffix would collide with the month or day feeds, e.g. o/d/2021-10/
+		return fmt.Sprintf("%s"+"p"+"%d"+"/", prefix, page)
+	}
 	return fmt.Sprintf("%s"+"-"+"%d"+"/", prefix[:len(prefix)-1], page)
 }
 
+// the month and year feeds o/d/2006-01/ and o/d/2006/, see FeedFilters
+func isAggregateDaysUri(uri string) bool {
+	if !strings.HasPrefix(uri, uriPubDays) {
+		return false
+	}
+	l := len(uri) - len(uriPubDays+"/")
+	return len("2006") == l || len("2006-01") == l
+}
+
 func computePageCount(count int, entriesPerPage int) int {
 	if count == 0 {
 		// even 0 entries need one (empty) page
@@ -202,16 +269,10 @@ func (seed Feed) Pages(entriesPerPage int) []Feed {
 		feed := seed
 
 		{
+			// archive pages are full and counted from the oldest entry, so they
+			// stay put when posting. Only the newest (subscription) page varies.
 			upper := lower
-			step := entriesPerPage
-			if page == pageCount-2 {
-				// only the page BEFORE the last one has variable length (if needed)
-				step = totalEntries % entriesPerPage
-				if 0 == step {
-					step = entriesPerPage
-				}
-			}
-			lower = max(0, upper-step)
+			lower = max(0, upper-entriesPerPage)
 			feed.Entries = seed.Entries[lower:upper]
 			feed.Updated = iso8601(time.Time{}) // start with zero
 			for _, ent := range feed.Entries {  // max of entries
@@ -232,9 +293,23 @@ func (seed Feed) Pages(entriesPerPage int) []Feed {
 				ls = append(ls, link(relPrevious, page+1)) // newer, i.e. higher page number
 			}
 			ls = append(ls, link(relFirst, pageCount-1)) // newest, i.e. largest page number
+
+			// https://tools.ietf.org/html/rfc5005#section-4
+			if page > 0 {
+				ls = append(ls, link(relPrevArchive, page-1))
+			}
+			if page < pageCount-1 {
+				feed.XmlNSFeedHistory = fhNamespace
+				feed.Archive = true
+				ls = append(ls, link(relCurrent, pageCount-1)) // the subscription document
+				if page+1 < pageCount-1 {
+					ls = append(ls, link(relNextArchive, page+1))
+				}
+			}
 		} else {
-			// TODO https://tools.ietf.org/html/rfc5005#section-2
-			// xmlns:fh="http://purl.org/syndication/history/1.0" <fh:complete/>
+			// https://tools.ietf.org/html/rfc5005#section-2
+			feed.XmlNSFeedHistory = fhNamespace
+			feed.Complete = true
 		}
 		feed.Links = ls
 		ret = append(ret, feed)
@@ -280,6 +355,21 @@ func (feed Feed) PagedFeeds(complete []Feed, linksPerPage int) ([]Feed, error) {
 		pages = append(pages, comp.Pages(linksPerPage)...)
 	}
 
+	// chronological siblings, in reading order like the paged feeds: previous is newer, next is older.
+	pub := publicEntries(feed.Entries)
+	sort.Sort(ByPublishedDesc(pub))
+	sibling := make(map[*Entry][]Link, len(pub))
+	for i, entry := range pub {
+		ls := make([]Link, 0, 2)
+		if i > 0 {
+			ls = append(ls, Link{Rel: relPrevious, Href: path.Join(uriPub, uriPosts, string(pub[i-1].Id)) + "/", Title: pub[i-1].Title.Body})
+		}
+		if i+1 < len(pub) {
+			ls = append(ls, Link{Rel: relNext, Href: path.Join(uriPub, uriPosts, string(pub[i+1].Id)) + "/", Title: pub[i+1].Title.Body})
+		}
+		sibling[entry] = ls
+	}
+
 	// do before writing but after all matching is done:
 	catScheme := Iri(xmlBase.ResolveReference(mustParseURL(path.Join(uriPub, uriTags))).String() + "/")
 	for _, entry := range feed.Entries {
@@ -291,15 +381,21 @@ func (feed Feed) PagedFeeds(complete []Feed, linksPerPage int) ([]Feed, error) {
 		upURL := mustParseURL(path.Join(uriPub, uriPosts) + "/")
 		selfURL := mustParseURL(path.Join(uriPub, uriPosts, string(entry.Id)) + "/")
 		editURL := strings.Join([]string{cgiName, "?post=", selfURL.String()}, "")
+		historyURL := path.Join(cgiName, uriHistory, string(entry.Id)) + "/"
 		entry.Id = Id(xmlBase.ResolveReference(selfURL).String()) // expand XmlBase as required by https://validator.w3.org/feed/check.cgi?url=
 		entry.Links = append(entry.Links,
 			Link{Rel: relSelf, Href: selfURL.String()},
 			Link{Rel: relEdit, Href: editURL},
+			Link{Rel: relVersionHistory, Href: historyURL},
 			// Link{Rel: relEditMedia, Href: editURL},
 			Link{Rel: relUp, Href: upURL.String(), Title: feed.Title.Body}, // we need the feed-name somewhere.
 		)
+		dayStr := entry.Published.Format(time.RFC3339[:10])
+		entry.pageLinks = append(append([]Link{}, sibling[entry]...), Link{Rel: relUp, Href: uriPubDays + dayStr + "/", Title: dayStr})
 		for i := range entry.Categories {
 			entry.Categories[i].Scheme = catScheme
+			trm := entry.Categories[i].Term
+			entry.pageLinks = append(entry.pageLinks, Link{Rel: relUp, Href: uriPubTags + url.PathEscape(trm) + "/", Title: "#" + trm})
 		}
 	}
 
@@ -312,14 +408,31 @@ func (app Server) PublishFeedsForModifiedEntries(feed Feed, entries []*Entry) er
 	feed.Generator = &Generator{Uri: myselfNamespace, Version: version, Body: "🌺 ShaarliGo"}
 	sort.Sort(ByPublishedDesc(feed.Entries))
 	// entries = feed.Entries // force write all entries. Every single one.
+	neighbours := neighbourEntries(publicEntries(feed.Entries), entries)
+	daily, err := feed.DailyDigests(entries, app.cfg.LinksPerPage) // before PagedFeeds modifies the entries
+	if err != nil {
+		return err
+	}
+	sitemap := sitemapUrls(string(feed.XmlBase), publicEntries(feed.Entries))
 	complete := feed.CompleteFeedsForModifiedEntries(entries)
 	if pages, err := feed.PagedFeeds(complete, app.cfg.LinksPerPage); err == nil {
 		if err = app.PublishFeeds(pages, true); err != nil {
 			return err
+		} else if err = publishCalendar(publicEntries(feed.Entries)); err != nil {
+			return err
+		} else if err = publishTagStats(publicEntries(feed.Entries)); err != nil {
+			return err
+		} else if err = app.PublishDaily(daily); err != nil {
+			return err
+		} else if err = publishSitemap(string(feed.XmlBase), sitemap); err != nil {
+			return err
 		} else {
 			// just assure ALL entries index.xml.gz exist and are up to date
 			for _, ent := range feed.Entries {
-				if err = app.PublishEntry(ent, false); err != nil { // only if newer
+				if !ent.isPublic() {
+					continue
+				}
+				if err = app.PublishEntry(ent, neighbours[ent]); err != nil { // only if newer or a neighbour
 					return err
 				}
 			}
@@ -330,59 +443,41 @@ func (app Server) PublishFeedsForModifiedEntries(feed Feed, entries []*Entry) er
 	}
 }
 
-// create a lock file to avoid races and then call PublishFeed in loop
+// call PublishFeed in loop.
+//
+// Callers modifying the feed storage hold lockFeedStorage, see lock.go
 func (app Server) PublishFeeds(feeds []Feed, force bool) error {
 	defer un(trace("App.PublishFeeds"))
-	strFileLock := filepath.Join(dirApp, "var", "lock")
-
-	// check race: if .lock exists kill pid?
-	if byPid, err := ioutil.ReadFile(strFileLock); err == nil {
-		if pid, err := strconv.Atoi(string(byPid)); err == nil {
-			if proc, er := os.FindProcess(pid); er == nil {
-				err = proc.Kill()
-			}
-		}
-		if err != nil {
+	for _, feed := range feeds {
+		if err := app.PublishFeed(feed, force); err != nil {
 			return err
 		}
-		if err = os.Remove(strFileLock); err != nil {
-			return err
-		}
-	}
-
-	// create .lock file with pid
-	if err := ioutil.WriteFile(strFileLock, []byte(fmt.Sprint(os.Getpid())), os.ModeExclusive); err == nil {
-		defer os.Remove(strFileLock)
-		for _, feed := range feeds {
-			if err := app.PublishFeed(feed, force); err != nil {
-				return err
+		if uriPubTags == LinkRelSelf(feed.Links).Href {
+			// write additional index.json with all (public) category terms
+			const jsonFileName = "index.json"
+			tags := make([]string, 0, len(feed.Categories))
+			for _, cat := range feed.Categories {
+				tags = append(tags, "#"+cat.Term)
 			}
-			if uriPubTags == LinkRelSelf(feed.Links).Href {
-				// write additional index.json with all (public) category terms
-				const jsonFileName = "index.json"
-				tags := make([]string, 0, len(feed.Categories))
-				for _, cat := range feed.Categories {
-					tags = append(tags, "#"+cat.Term)
-				}
-				dstDirName := filepath.FromSlash(uriPubTags)
-				dstFileName := filepath.Join(dstDirName, jsonFileName)
-				tmpFileName := dstFileName + "~"
-				var w *os.File
-				if w, err = os.Create(tmpFileName); err == nil {
-					defer w.Close() // just to be sure
-					enc := json.NewEncoder(w)
-					if err = enc.Encode(tags); err == nil {
-						if err = w.Close(); err == nil {
-							if err := os.Rename(tmpFileName, dstFileName); err != nil {
-								return err
-							}
+			dstDirName := filepath.FromSlash(uriPubTags)
+			dstFileName := filepath.Join(dstDirName, jsonFileName)
+			tmpFileName := dstFileName + "~"
+			if w, err := os.Create(tmpFileName); err == nil {
+				defer w.Close() // just to be sure
+				enc := json.NewEncoder(w)
+				if err = enc.Encode(tags); err == nil {
+					if err = w.Close(); err == nil {
+						if err := os.Rename(tmpFileName, dstFileName); err != nil {
+							return err
+						}
+						if err := gzipSibling(dstFileName, time.Time(feed.Updated)); err != nil {
+							return err
 						}
 					}
 				}
 			}
 		}
 	}
-
 	return nil
 }
 
@@ -401,15 +496,22 @@ func (app Server) PublishFeed(feed Feed, force bool) error {
 		"../../../" == pathPrefix
 	if remove {
 		log.Printf("remove %s", dstFileName)
-		err := os.Remove(dstFileName)
+		err := removeWithGzipSibling(dstFileName)
+		removeWithGzipSibling(filepath.Join(dstDirName, jsonFeedFileName))
+		removeWithGzipSibling(filepath.Join(dstDirName, rssFileName))
 		os.Remove(dstDirName)
 		defer un(ti, to)
+		if os.IsNotExist(err) {
+			return nil // e.g. the day of a private post
+		}
 		return err
 	}
 
-	feed.Id = Id(string(feed.XmlBase) + string(feed.Id))
-	mTime := time.Time(feed.Updated)
-	var feedOrEntry interface{} = feed
+	withRss := hasRss(uri, feed.Id)
+	if withRss {
+		// autodiscovery, see rss.go
+		feed.Links = append(feed.Links, Link{Rel: relAlternate, Type: mimeRss, Href: uri + rssFileName})
+	}
 	if "../../../" == pathPrefix && strings.HasPrefix(uri, uriPubPosts) {
 		if 0 == len(feed.Entries) {
 			return fmt.Errorf("Invalid feed, self: %v len(entries): %d", uri, len(feed.Entries))
@@ -417,13 +519,15 @@ func (app Server) PublishFeed(feed Feed, force bool) error {
 		if 1 < len(feed.Entries) {
 			log.Printf("%d entries with Id: %v, keeping just one.", len(feed.Entries), uri)
 		}
-		ent := feed.Entries[0]
-		feedOrEntry = ent
-		mTime = time.Time(ent.Updated)
-		return nil // do nothing. Single entries should pe published differently.
+		// single entries are published as such
+		return app.PublishEntry(feed.Entries[0], force)
 	}
+	feed.Links = append(feed.Links, app.linkOpenSearch()) // autodiscovery, see opensearch.go
+	feed.Id = Id(string(feed.XmlBase) + string(feed.Id))
+	mTime := time.Time(feed.Updated)
 
-	if fi, err := os.Stat(dstFileName); !force && (fi != nil && !fi.ModTime().Before(mTime)) && !os.IsNotExist(err) {
+	// the .gz is written last, so it's the one telling whether we're up to date
+	if fi, err := os.Stat(dstFileName + gzSuffix); !force && (fi != nil && !fi.ModTime().Before(mTime)) && !os.IsNotExist(err) {
 		// log.Printf("skip %s, still up to date.", dstFileName)
 		return err
 	}
@@ -439,11 +543,27 @@ func (app Server) PublishFeed(feed Feed, force bool) error {
 			defer w.Close() // just to be sure
 			enc := xml.NewEncoder(w)
 			enc.Indent("", "  ")
-			if err = xmlEncodeWithXslt(feedOrEntry, xslt, enc); err == nil {
+			if err = xmlEncodeWithXslt(feed, xslt, enc); err == nil {
 				if err = enc.Flush(); err == nil {
 					if err = w.Close(); err == nil {
 						os.Chtimes(tmpFileName, mTime, mTime)
-						return os.Rename(tmpFileName, dstFileName)
+						if err = os.Rename(tmpFileName, dstFileName); err == nil {
+							err = gzipSibling(dstFileName, mTime)
+						}
+						if err == nil && uriPubTags != uri {
+							// o/t/index.json is the tag list, see PublishFeeds
+							dst := filepath.Join(dstDirName, jsonFeedFileName)
+							if err = feed.saveJsonFeed(dst, mTime); err == nil {
+								err = gzipSibling(dst, mTime)
+							}
+						}
+						if err == nil && withRss {
+							dst := filepath.Join(dstDirName, rssFileName)
+							if err = feed.saveRss(dst, mTime); err == nil {
+								err = gzipSibling(dst, mTime)
+							}
+						}
+						return err
 					}
 				}
 			}
@@ -452,6 +572,9 @@ func (app Server) PublishFeed(feed Feed, force bool) error {
 	return err
 }
 
+// write o/p/<id>/index.xml for a single entry as prepared by PagedFeeds, i.e.
+// with absolute id plus the previous, next and up links of Entry.pageLinks, which
+// the feeds don't carry. Skip if up to date unless forced.
 func (app Server) PublishEntry(ent *Entry, force bool) error {
 	const feedFileName = "index.xml"
 	const xsltFileName = "posts.xslt"
@@ -462,11 +585,10 @@ func (app Server) PublishEntry(ent *Entry, force bool) error {
 	dstDirName := filepath.FromSlash(uri)
 	dstFileName := filepath.Join(dstDirName, feedFileName)
 
-	var feedOrEntry interface{} = ent
-	ent.Id = Id(string(ent.XmlBase) + string(ent.Id))
 	mTime := time.Time(ent.Updated)
 
-	if fi, err := os.Stat(dstFileName); !force && (fi != nil && !fi.ModTime().Before(mTime)) && !os.IsNotExist(err) {
+	// the .gz is written last, so it's the one telling whether we're up to date
+	if fi, err := os.Stat(dstFileName + gzSuffix); !force && (fi != nil && !fi.ModTime().Before(mTime)) && !os.IsNotExist(err) {
 		// log.Printf("skip %s, still up to date.", dstFileName)
 		return err
 	}
@@ -481,11 +603,16 @@ func (app Server) PublishEntry(ent *Entry, force bool) error {
 		if w, err = os.Create(tmpFileName); err == nil {
 			enc := xml.NewEncoder(w)
 			enc.Indent("", "  ")
-			if err = xmlEncodeWithXslt(feedOrEntry, xslt, enc); err == nil {
+			page := *ent
+			page.Links = append(append([]Link{}, ent.Links...), ent.pageLinks...)
+			if err = xmlEncodeWithXslt(&page, xslt, enc); err == nil {
 				if err = enc.Flush(); err == nil {
 					if err = w.Close(); err == nil {
 						os.Chtimes(tmpFileName, mTime, mTime)
-						return os.Rename(tmpFileName, dstFileName)
+						if err = os.Rename(tmpFileName, dstFileName); err == nil {
+							err = gzipSibling(dstFileName, mTime)
+						}
+						return err
 					}
 				}
 			}
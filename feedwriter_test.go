@@ -18,8 +18,12 @@
 package main
 
 import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"time"
@@ -84,6 +88,8 @@ func TestEntryFeedFilters(t *testing.T) {
 	keys := uriSliceSorted(itm.FeedFilters(nil))
 	assert.Equal(t, []string{
 		uriPubDays + "2010-12-31" + "/",
+		uriPubDays + "2010-12" + "/",
+		uriPubDays + "2010" + "/",
 		uriPubPosts,
 		uriPubPosts + "id_0" + "/",
 		uriPubTags,
@@ -91,6 +97,25 @@ func TestEntryFeedFilters(t *testing.T) {
 	}, keys, "Oha")
 }
 
+func TestCompleteFeedsSkipPrivate(t *testing.T) {
+	t.Parallel()
+	pub := &Entry{Id: "pub", Categories: []Category{{Term: "a"}}}
+	pri := &Entry{Id: "pri", Categories: []Category{{Term: "a"}, {Term: "secret"}}, Private: true}
+	feed := Feed{Entries: []*Entry{pub, pri}}
+
+	uri2filter := pri.FeedFilters(pub.FeedFilters(nil))
+	for _, comp := range feed.CompleteFeeds(uri2filter) {
+		switch comp.Id {
+		case uriPubPosts, uriPubTags + "a/":
+			assert.Equal(t, []*Entry{pub}, comp.Entries, string(comp.Id))
+		case uriPubTags:
+			assert.Equal(t, []Category{{Term: "a", Label: "1"}}, comp.Categories, "no private tags")
+		case uriPubPosts + "pri/", uriPubTags + "secret/":
+			assert.Equal(t, 0, len(comp.Entries), string(comp.Id))
+		}
+	}
+}
+
 func TestPathJoin(t *testing.T) {
 	t.Parallel()
 	assert.Equal(t, "a/b", path.Join("a", "b", ""), "Oha")
@@ -102,6 +127,38 @@ func TestAppendPageNumber(t *testing.T) {
 	assert.Equal(t, "/", s[len(s)-1:], "Oha")
 	assert.Equal(t, uriPub+"/"+uriPosts+"-"+"0"+"/", appendPageNumber(uriPubPosts, 0, 1+1), "Oha")
 	assert.Equal(t, uriPubPosts, appendPageNumber(uriPubPosts, 1, 1+1), "Oha")
+	assert.Equal(t, "o/d/2021-01-01-0/", appendPageNumber("o/d/2021-01-01/", 0, 2), "day")
+	assert.Equal(t, "o/d/2021-01/p10/", appendPageNumber("o/d/2021-01/", 10, 12), "month")
+	assert.Equal(t, "o/d/2021/p10/", appendPageNumber("o/d/2021/", 10, 12), "year")
+}
+
+func TestPublishYearWithManyPages(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 1}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	for d := 1; d <= 14; d++ {
+		_, err := feed.Append(&Entry{Id: Id(fmt.Sprintf("e%d", d)), Title: HumanText{Body: "x"}, Published: iso8601(time.Date(2021, 1, d, 12, 0, 0, 0, time.UTC))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	// the day and month feeds, not pages of the month or year feeds:
+	for _, dir := range []string{"2021-01-10", "2021-01-11", "2021-01-12"} {
+		f, err := loadFeedFile(filepath.Join("o", "d", dir, "index.xml"))
+		assert.Nil(t, err, dir)
+		assert.Equal(t, 1, len(f.Entries), dir)
+		assert.Equal(t, "o/d/"+dir+"/", LinkRelSelf(f.Links).Href, dir)
+	}
+	for _, dir := range []string{"2021/p12", "2021-01/p12"} {
+		f, err := loadFeedFile(filepath.Join("o", "d", filepath.FromSlash(dir), "index.xml"))
+		assert.Nil(t, err, dir)
+		assert.Equal(t, "o/d/"+dir+"/", LinkRelSelf(f.Links).Href, dir)
+		assert.Equal(t, 1, len(f.Entries), dir)
+	}
+	for _, dir := range []string{"2021-10", "2021-11", "2021-12"} {
+		_, err := os.Stat(filepath.Join("o", "d", dir))
+		assert.True(t, os.IsNotExist(err), dir)
+	}
 }
 
 func TestWriteFeedsEmpty0(t *testing.T) {
@@ -122,22 +179,28 @@ func TestWriteFeedsAddOneAndOneAndRemoveFirst(t *testing.T) {
 
 		complete := feed.CompleteFeedsForModifiedEntries([]*Entry{entry})
 
-		assert.Equal(t, 5, len(complete), "ja")
+		assert.Equal(t, 7, len(complete), "ja")
 
 		assert.Equal(t, Id(uriPubDays+"2010-12-31"+"/"), complete[0].Id, "ja")
 		assert.Equal(t, 1, len(complete[0].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts), complete[1].Id, "ja")
+		assert.Equal(t, Id(uriPubDays+"2010-12"+"/"), complete[1].Id, "ja")
 		assert.Equal(t, 1, len(complete[1].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts+"id_0/"), complete[2].Id, "ja")
+		assert.Equal(t, Id(uriPubDays+"2010"+"/"), complete[2].Id, "ja")
 		assert.Equal(t, 1, len(complete[2].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags), complete[3].Id, "ja")
-		assert.Equal(t, 0, len(complete[3].Entries), "ja")
+		assert.Equal(t, Id(uriPubPosts), complete[3].Id, "ja")
+		assert.Equal(t, 1, len(complete[3].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags+"🐳/"), complete[4].Id, "ja")
+		assert.Equal(t, Id(uriPubPosts+"id_0/"), complete[4].Id, "ja")
 		assert.Equal(t, 1, len(complete[4].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags), complete[5].Id, "ja")
+		assert.Equal(t, 0, len(complete[5].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags+"🐳/"), complete[6].Id, "ja")
+		assert.Equal(t, 1, len(complete[6].Entries), "ja")
 	}
 	{
 		entry := &Entry{
@@ -150,22 +213,28 @@ func TestWriteFeedsAddOneAndOneAndRemoveFirst(t *testing.T) {
 
 		complete := feed.CompleteFeedsForModifiedEntries([]*Entry{entry})
 
-		assert.Equal(t, 5, len(complete), "ja")
+		assert.Equal(t, 7, len(complete), "ja")
 
 		assert.Equal(t, Id(uriPubDays+"2010-12-30"+"/"), complete[0].Id, "ja")
 		assert.Equal(t, 1, len(complete[0].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts), complete[1].Id, "ja")
+		assert.Equal(t, Id(uriPubDays+"2010-12"+"/"), complete[1].Id, "ja")
 		assert.Equal(t, 2, len(complete[1].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts+"id_1"+"/"), complete[2].Id, "ja")
-		assert.Equal(t, 1, len(complete[2].Entries), "ja")
+		assert.Equal(t, Id(uriPubDays+"2010"+"/"), complete[2].Id, "ja")
+		assert.Equal(t, 2, len(complete[2].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags), complete[3].Id, "ja")
-		assert.Equal(t, 0, len(complete[3].Entries), "ja")
+		assert.Equal(t, Id(uriPubPosts), complete[3].Id, "ja")
+		assert.Equal(t, 2, len(complete[3].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags+"foo"+"/"), complete[4].Id, "ja")
+		assert.Equal(t, Id(uriPubPosts+"id_1"+"/"), complete[4].Id, "ja")
 		assert.Equal(t, 1, len(complete[4].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags), complete[5].Id, "ja")
+		assert.Equal(t, 0, len(complete[5].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags+"foo"+"/"), complete[6].Id, "ja")
+		assert.Equal(t, 1, len(complete[6].Entries), "ja")
 	}
 	{
 		e0 := *feed.Entries[0]
@@ -173,22 +242,28 @@ func TestWriteFeedsAddOneAndOneAndRemoveFirst(t *testing.T) {
 
 		complete := feed.CompleteFeedsForModifiedEntries([]*Entry{&e0})
 
-		assert.Equal(t, 5, len(complete), "ja")
+		assert.Equal(t, 7, len(complete), "ja")
 
 		assert.Equal(t, Id(uriPubDays+"2010-12-31"+"/"), complete[0].Id, "ja")
 		assert.Equal(t, 0, len(complete[0].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts), complete[1].Id, "ja")
+		assert.Equal(t, Id(uriPubDays+"2010-12"+"/"), complete[1].Id, "ja")
 		assert.Equal(t, 1, len(complete[1].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubPosts+"id_0"+"/"), complete[2].Id, "ja")
-		assert.Equal(t, 0, len(complete[2].Entries), "ja")
+		assert.Equal(t, Id(uriPubDays+"2010"+"/"), complete[2].Id, "ja")
+		assert.Equal(t, 1, len(complete[2].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags), complete[3].Id, "ja")
-		assert.Equal(t, 0, len(complete[3].Entries), "ja")
+		assert.Equal(t, Id(uriPubPosts), complete[3].Id, "ja")
+		assert.Equal(t, 1, len(complete[3].Entries), "ja")
 
-		assert.Equal(t, Id(uriPubTags+"🐳"+"/"), complete[4].Id, "ja")
+		assert.Equal(t, Id(uriPubPosts+"id_0"+"/"), complete[4].Id, "ja")
 		assert.Equal(t, 0, len(complete[4].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags), complete[5].Id, "ja")
+		assert.Equal(t, 0, len(complete[5].Entries), "ja")
+
+		assert.Equal(t, Id(uriPubTags+"🐳"+"/"), complete[6].Id, "ja")
+		assert.Equal(t, 0, len(complete[6].Entries), "ja")
 	}
 }
 
@@ -221,11 +296,11 @@ func TestWriteFeedsPaged(t *testing.T) {
 	sort.Sort(ByPublishedDesc(feed.Entries))
 
 	complete := feed.CompleteFeedsForModifiedEntries(feed.Entries)
-	assert.Equal(t, 7, len(complete), "uhu")
+	assert.Equal(t, 9, len(complete), "uhu")
 
 	pages, err := feed.PagedFeeds(complete, 1)
 	assert.Nil(t, err, "uhu")
-	assert.Equal(t, 10, len(pages), "uhu")
+	assert.Equal(t, 16, len(pages), "uhu")
 
 	i := 0
 	assert.Equal(t, Id(uriPubDays+"1990-12-30/"), pages[i].Id, "ja")
@@ -240,6 +315,14 @@ func TestWriteFeedsPaged(t *testing.T) {
 	assert.Equal(t, uriPubDays+"1990-12-31/", LinkRelSelf(pages[i].Links).Href, "ja")
 	assert.Equal(t, 1, len(pages[i].Entries), "ja")
 	i++
+	for _, agg := range []string{"1990-12", "1990"} {
+		for _, self := range []string{agg + "/p0/", agg + "/p1/", agg + "/"} {
+			assert.Equal(t, Id(uriPubDays+agg+"/"), pages[i].Id, "ja")
+			assert.Equal(t, uriPubDays+self, LinkRelSelf(pages[i].Links).Href, "ja")
+			assert.Equal(t, 1, len(pages[i].Entries), "ja")
+			i++
+		}
+	}
 	assert.Equal(t, Id(uriPubPosts), pages[i].Id, "ja")
 	assert.Equal(t, uriPub+"/"+uriPosts+"-"+"0"+"/", LinkRelSelf(pages[i].Links).Href, "ja")
 	assert.Equal(t, 1, len(pages[i].Entries), "ja")
@@ -279,42 +362,192 @@ func TestPagedFeeds(t *testing.T) {
 	feed.XmlBase = "http://foo.eu/s/"
 
 	feeds := feed.CompleteFeedsForModifiedEntries([]*Entry{feed.Entries[0]})
-	assert.Equal(t, 4, len(feeds), "ja")
+	assert.Equal(t, 6, len(feeds), "ja")
 	assert.Equal(t, Id(uriPubDays+"2018-01-22/"), feeds[0].Id, "ja")
-	assert.Equal(t, Id(uriPubPosts), feeds[1].Id, "ja")
-	assert.Equal(t, Id(uriPubPosts+"XsuMcA/"), feeds[2].Id, "ja")
-	assert.Equal(t, Id(uriPubTags), feeds[3].Id, "ja")
+	assert.Equal(t, Id(uriPubDays+"2018-01/"), feeds[1].Id, "ja")
+	assert.Equal(t, Id(uriPubDays+"2018/"), feeds[2].Id, "ja")
+	assert.Equal(t, Id(uriPubPosts), feeds[3].Id, "ja")
+	assert.Equal(t, Id(uriPubPosts+"XsuMcA/"), feeds[4].Id, "ja")
+	assert.Equal(t, Id(uriPubTags), feeds[5].Id, "ja")
 
 	// test low level
-	assert.Equal(t, uriPubPosts, LinkRelSelf(feeds[1].Pages(100)[0].Links).Href, "ja")
+	assert.Equal(t, uriPubPosts, LinkRelSelf(feeds[3].Pages(100)[0].Links).Href, "ja")
 
 	pages := make([]Feed, 0, 2*len(feeds))
 	for _, comp := range feeds {
 		pages = append(pages, comp.Pages(100)...)
 	}
-	assert.Equal(t, 4, len(pages), "ja")
-	assert.Equal(t, Id(uriPubPosts), pages[1].Id, "ja")
-	assert.Equal(t, uriPubPosts, LinkRelSelf(pages[1].Links).Href, "ja")
+	assert.Equal(t, 6, len(pages), "ja")
+	assert.Equal(t, Id(uriPubPosts), pages[3].Id, "ja")
+	assert.Equal(t, uriPubPosts, LinkRelSelf(pages[3].Links).Href, "ja")
 
 	// high level
 	pages, err = feed.PagedFeeds(feeds, 100)
 	assert.Nil(t, err, "ja")
-	assert.Equal(t, 4, len(pages), "ja")
+	assert.Equal(t, 6, len(pages), "ja")
 	assert.Equal(t, Id(uriPubDays+"2018-01-22/"), pages[0].Id, "ja")
-	assert.Equal(t, Id(uriPubPosts), pages[1].Id, "ja")
-	assert.Equal(t, Id(uriPubPosts+"XsuMcA/"), pages[2].Id, "ja")
-	assert.Equal(t, Id(uriPubTags), pages[3].Id, "ja")
+	assert.Equal(t, Id(uriPubDays+"2018-01/"), pages[1].Id, "ja")
+	assert.Equal(t, Id(uriPubDays+"2018/"), pages[2].Id, "ja")
+	assert.Equal(t, Id(uriPubPosts), pages[3].Id, "ja")
+	assert.Equal(t, Id(uriPubPosts+"XsuMcA/"), pages[4].Id, "ja")
+	assert.Equal(t, Id(uriPubTags), pages[5].Id, "ja")
 
 	assert.Equal(t, uriPubDays+"2018-01-22/", LinkRelSelf(pages[0].Links).Href, "ja")
-	assert.Equal(t, uriPubPosts, LinkRelSelf(pages[1].Links).Href, "ja")
-	assert.Equal(t, uriPubPosts+"XsuMcA/", LinkRelSelf(pages[2].Links).Href, "ja")
-	assert.Equal(t, uriPubTags, LinkRelSelf(pages[3].Links).Href, "ja")
+	assert.Equal(t, uriPubDays+"2018-01/", LinkRelSelf(pages[1].Links).Href, "ja")
+	assert.Equal(t, uriPubDays+"2018/", LinkRelSelf(pages[2].Links).Href, "ja")
+	assert.Equal(t, uriPubPosts, LinkRelSelf(pages[3].Links).Href, "ja")
+	assert.Equal(t, uriPubPosts+"XsuMcA/", LinkRelSelf(pages[4].Links).Href, "ja")
+	assert.Equal(t, uriPubTags, LinkRelSelf(pages[5].Links).Href, "ja")
 
-	pages = feeds[1].Pages(100)
+	pages = feeds[3].Pages(100)
 	assert.Equal(t, Id(uriPubPosts), pages[0].Id, "ja")
 	assert.Equal(t, uriPubPosts, LinkRelSelf(pages[0].Links).Href, "ja")
 }
 
+func TestPagesArchived(t *testing.T) {
+	t.Parallel()
+	seed := Feed{Id: Id(uriPubPosts)}
+	for _, id := range []string{"e", "d", "c", "b", "a"} { // newest first
+		seed.Entries = append(seed.Entries, &Entry{Id: Id(id)})
+	}
+	pages := seed.Pages(2)
+	assert.Equal(t, 3, len(pages), "aha")
+
+	ids := func(f Feed) (ret []Id) {
+		for _, ent := range f.Entries {
+			ret = append(ret, ent.Id)
+		}
+		return
+	}
+	// archives are full and start at the oldest, the subscription page takes the rest
+	assert.Equal(t, []Id{"b", "a"}, ids(pages[0]), "aha")
+	assert.Equal(t, []Id{"d", "c"}, ids(pages[1]), "aha")
+	assert.Equal(t, []Id{"e"}, ids(pages[2]), "aha")
+
+	assert.Equal(t, "o/p-0/", LinkRelSelf(pages[0].Links).Href, "aha")
+	assert.True(t, bool(pages[0].Archive), "aha")
+	assert.False(t, bool(pages[0].Complete), "aha")
+	assert.Equal(t, "", LinkRel(relPrevArchive, pages[0].Links).Href, "aha")
+	assert.Equal(t, "o/p-1/", LinkRel(relNextArchive, pages[0].Links).Href, "aha")
+	assert.Equal(t, uriPubPosts, LinkRel(relCurrent, pages[0].Links).Href, "aha")
+
+	assert.True(t, bool(pages[1].Archive), "aha")
+	assert.Equal(t, "o/p-0/", LinkRel(relPrevArchive, pages[1].Links).Href, "aha")
+	assert.Equal(t, "", LinkRel(relNextArchive, pages[1].Links).Href, "aha")
+	assert.Equal(t, uriPubPosts, LinkRel(relCurrent, pages[1].Links).Href, "aha")
+
+	assert.False(t, bool(pages[2].Archive), "aha")
+	assert.Equal(t, "", pages[2].XmlNSFeedHistory, "aha")
+	assert.Equal(t, "o/p-1/", LinkRel(relPrevArchive, pages[2].Links).Href, "aha")
+	assert.Equal(t, "", LinkRel(relCurrent, pages[2].Links).Href, "aha")
+
+	// posting one more keeps the archives as they were
+	seed.Entries = append([]*Entry{{Id: "f"}}, seed.Entries...)
+	more := seed.Pages(2)
+	assert.Equal(t, 3, len(more), "aha")
+	assert.Equal(t, ids(pages[0]), ids(more[0]), "aha")
+	assert.Equal(t, ids(pages[1]), ids(more[1]), "aha")
+	assert.Equal(t, []Id{"f", "e"}, ids(more[2]), "aha")
+}
+
+func TestPagesComplete(t *testing.T) {
+	t.Parallel()
+	seed := Feed{Id: Id(uriPubPosts), Entries: []*Entry{{Id: "a"}}}
+	pages := seed.Pages(2)
+	assert.Equal(t, 1, len(pages), "aha")
+	assert.True(t, bool(pages[0].Complete), "aha")
+	assert.False(t, bool(pages[0].Archive), "aha")
+
+	buf, err := xml.Marshal(pages[0])
+	assert.Nil(t, err, "aha")
+	assert.Contains(t, string(buf), ` xmlns:fh="http://purl.org/syndication/history/1.0"`, "aha")
+	assert.Contains(t, string(buf), `<fh:complete></fh:complete>`, "aha")
+	assert.NotContains(t, string(buf), `fh:archive`, "aha")
+}
+
+func TestNeighbourEntries(t *testing.T) {
+	t.Parallel()
+	ent := func(id string, day int) *Entry {
+		return &Entry{Id: Id(id), Published: iso8601(time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC))}
+	}
+	a, b, c, d := ent("a", 4), ent("b", 3), ent("c", 2), ent("d", 1)
+	pub := []*Entry{a, b, c, d}
+
+	assert.Equal(t, map[*Entry]bool{a: true, c: true}, neighbourEntries(pub, []*Entry{b}), "present")
+	assert.Equal(t, map[*Entry]bool{b: true}, neighbourEntries(pub, []*Entry{a}), "newest")
+	assert.Equal(t, map[*Entry]bool{c: true}, neighbourEntries(pub, []*Entry{d}), "oldest")
+	assert.Equal(t, map[*Entry]bool{b: true, c: true}, neighbourEntries(pub, []*Entry{ent("x", 2)}), "gone, e.g. deleted")
+	// edit moving b to the past: the old version's neighbours as well as the new ones
+	b0 := *b
+	b.Published = ent("b", 0).Published
+	pub = []*Entry{a, c, d, b}
+	assert.Equal(t, map[*Entry]bool{a: true, c: true, d: true}, neighbourEntries(pub, []*Entry{b, &b0}), "moved")
+}
+
+func TestPublishEntrySiblings(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	add := func(id string, day int) *Entry {
+		ent := &Entry{Id: Id(id), Title: HumanText{Body: id}, Categories: []Category{{Term: "foo"}}, Published: iso8601(time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC))}
+		_, err := feed.Append(ent)
+		assert.Nil(t, err, "aha")
+		return ent
+	}
+	load := func(id string) Entry {
+		ent := Entry{}
+		b, err := ioutil.ReadFile(filepath.Join("o", "p", id, "index.xml"))
+		assert.Nil(t, err, "aha")
+		assert.Nil(t, xml.Unmarshal(b, &ent), "aha")
+		return ent
+	}
+	add("a", 1)
+	add("b", 2)
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	// publishing mutates the entries, so start over from storage like the app does
+	feed = Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	add("a", 1)
+	add("b", 2)
+	c := add("c", 3)
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, []*Entry{c}), "aha")
+
+	b := load("b")
+	assert.Equal(t, Id("http://example.com/o/p/b/"), b.Id, "absolute, but just once")
+	assert.Equal(t, Link{Rel: relPrevious, Href: "o/p/c/", Title: "c"}, LinkRel(relPrevious, b.Links), "newer, republished as a neighbour")
+	assert.Equal(t, Link{Rel: relNext, Href: "o/p/a/", Title: "a"}, LinkRel(relNext, b.Links), "older")
+	ups := []string{}
+	for _, l := range b.Links {
+		if relUp == l.Rel {
+			ups = append(ups, l.Href)
+		}
+	}
+	assert.Equal(t, []string{"o/p/", "o/d/2021-01-02/", "o/t/foo/"}, ups, "aha")
+
+	assert.Equal(t, "", LinkRel(relPrevious, load("c").Links).Href, "newest")
+	assert.Equal(t, "", LinkRel(relNext, load("a").Links).Href, "oldest")
+
+	byt, err := ioutil.ReadFile(filepath.Join("o", "p", "index.xml"))
+	assert.Nil(t, err, "aha")
+	assert.NotContains(t, string(byt), `rel="previous"`, "only on entry pages")
+	assert.NotContains(t, string(byt), `href="o/t/foo/"`, "only on entry pages")
+}
+
+func TestPublishEntryTagUpEscaped(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	_, err := feed.Append(&Entry{Id: "a", Title: HumanText{Body: "a"}, Categories: []Category{{Term: "a b?#%"}}, Published: iso8601(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))})
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	ent := Entry{}
+	byt, err := ioutil.ReadFile(filepath.Join("o", "p", "a", "index.xml"))
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, xml.Unmarshal(byt, &ent), "aha")
+	assert.Equal(t, Link{Rel: relUp, Href: "o/t/a%20b%3F%23%25/", Title: "#a b?#%"}, ent.Links[len(ent.Links)-1], "aha")
+}
+
 func BenchmarkFileStat(b *testing.B) {
 	t0 := time.Time{}
 	for i := 0; i < b.N; i++ {
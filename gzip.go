@@ -0,0 +1,68 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// precompressed siblings like o/p/index.xml.gz for cheap hosting without
+// on-the-fly compression, see .htaccess, app/99-lighttpd-shaarligo.conf and serveStatic
+
+const gzSuffix = ".gz"
+
+// write src + ".gz" with the same mtime as src.
+func gzipSibling(src string, mTime time.Time) error {
+	dst := src + gzSuffix
+	tmp := dst + "~"
+	var err error
+	var r *os.File
+	if r, err = os.Open(src); err == nil {
+		defer r.Close()
+		var w *os.File
+		if w, err = os.Create(tmp); err == nil {
+			defer w.Close() // just to be sure
+			var gz *gzip.Writer
+			if gz, err = gzip.NewWriterLevel(w, gzip.BestCompression); err == nil {
+				gz.Name = filepath.Base(src)
+				gz.ModTime = mTime
+				if _, err = io.Copy(gz, r); err == nil {
+					if err = gz.Close(); err == nil {
+						if err = w.Close(); err == nil {
+							os.Chtimes(tmp, mTime, mTime)
+							return os.Rename(tmp, dst)
+						}
+					}
+				}
+			}
+		}
+	}
+	return err
+}
+
+// remove file and its .gz sibling, if present.
+func removeWithGzipSibling(file string) error {
+	if err := os.Remove(file + gzSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(file)
+}
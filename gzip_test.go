@@ -0,0 +1,81 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGzipSibling(t *testing.T) {
+	defer prepTeardown(t)()
+	mTime := mustParseRFC3339("2021-01-02T03:04:05Z")
+	assert.Nil(t, ioutil.WriteFile("a.xml", []byte("<a/>"), 0644), "aha")
+	assert.Nil(t, gzipSibling("a.xml", mTime), "aha")
+
+	fi, err := os.Stat("a.xml.gz")
+	assert.Nil(t, err, "aha")
+	assert.True(t, mTime.Equal(fi.ModTime()), "aha")
+
+	f, _ := os.Open("a.xml.gz")
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "a.xml", r.Name, "aha")
+	b, err := ioutil.ReadAll(r)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "<a/>", string(b), "aha")
+
+	assert.Nil(t, removeWithGzipSibling("a.xml"), "aha")
+	_, err = os.Stat("a.xml.gz")
+	assert.True(t, os.IsNotExist(err), "aha")
+	_, err = os.Stat("a.xml")
+	assert.True(t, os.IsNotExist(err), "aha")
+}
+
+func TestPublishGzipSiblings(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	_, err := feed.Append(&Entry{Id: "a", Title: HumanText{Body: "a"}, Categories: []Category{{Term: "foo"}}, Published: iso8601(mustParseRFC3339("2021-01-01T00:00:00Z"))})
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	for _, file := range []string{
+		"o/p/index.xml",
+		"o/p/index.json",
+		"o/p/rss.xml",
+		"o/p/a/index.xml",
+		"o/t/index.json",
+		"o/t/foo/index.xml",
+	} {
+		fi, err := os.Stat(filepath.FromSlash(file))
+		assert.Nil(t, err, file)
+		gi, err := os.Stat(filepath.FromSlash(file) + gzSuffix)
+		assert.Nil(t, err, file)
+		if fi != nil && gi != nil {
+			assert.Equal(t, fi.ModTime().Truncate(time.Second), gi.ModTime().Truncate(time.Second), file)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prior revisions of each entry, kept in a sidecar Atom feed
+// app/var/history/<id>.atom and listed at shaarligo.cgi/history/<id>/
+// https://tools.ietf.org/html/rfc5829
+
+const uriHistory = "history"
+
+var dirHistory string
+
+func init() {
+	dirHistory = filepath.Join(dirApp, "var", uriHistory)
+}
+
+func historyFileName(id Id) string {
+	return filepath.Join(dirHistory, string(id)+".atom")
+}
+
+// oldest first
+func loadRevisions(id Id) ([]*Entry, error) {
+	feed, err := FeedFromFileName(historyFileName(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Entry{}, nil
+		}
+		return nil, err
+	}
+	sort.SliceStable(feed.Entries, func(i, j int) bool { return feed.Entries[i].Updated.Before(feed.Entries[j].Updated) })
+	return feed.Entries, nil
+}
+
+// remember prev if cur differs.
+func saveRevision(prev, cur Entry) error {
+	defer un(trace("saveRevision"))
+	if 0 == len(diffEntries(&prev, &cur)) {
+		return nil
+	}
+	revs, err := loadRevisions(prev.Id)
+	if err != nil {
+		return err
+	}
+	feed := Feed{
+		Id:      Id(path.Join(uriPub, uriPosts, string(prev.Id)) + "/"),
+		Title:   prev.Title,
+		Updated: iso8601(time.Now()),
+		Entries: append(revs, prev.clone()),
+	}
+	if err = os.MkdirAll(dirHistory, 0770); err != nil {
+		return err
+	}
+	dst := historyFileName(prev.Id)
+	tmp := dst + "~"
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err = enc.Encode(feed); err == nil {
+			if err = enc.Flush(); err == nil {
+				if err = w.Close(); err == nil {
+					return os.Rename(tmp, dst)
+				}
+			}
+		}
+	}
+	return err
+}
+
+type fieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// the fields an edit may change, see handleDoPost
+func revisionFields(ent *Entry) [][2]string {
+	link, content, image, private, draft := "", "", "", "", ""
+	if 0 < len(ent.Links) {
+		link = ent.Links[0].Href
+	}
+	if nil != ent.Content {
+		content = ent.Content.Body
+	}
+	if nil != ent.MediaThumbnail {
+		image = string(ent.MediaThumbnail.Url)
+	}
+	if ent.Private {
+		private = "🔒"
+	}
+	if ent.Draft {
+		draft = "📝"
+		if nil != ent.PublishAt {
+			draft += " " + ent.PublishAt.Format(time.RFC3339)
+		}
+	}
+	tags := make([]string, 0, len(ent.Categories))
+	for _, cat := range ent.Categories {
+		tags = append(tags, "#"+cat.Term)
+	}
+	return [][2]string{
+		{"title", ent.Title.Body},
+		{"link", link},
+		{"content", content},
+		{"tags", strings.Join(tags, " ")},
+		{"image", image},
+		{"private", private},
+		{"draft", draft},
+	}
+}
+
+func diffEntries(a, b *Entry) []fieldDiff {
+	fa, fb := revisionFields(a), revisionFields(b)
+	ret := []fieldDiff{}
+	for i := range fa {
+		if fa[i][1] != fb[i][1] {
+			ret = append(ret, fieldDiff{Field: fa[i][0], Old: fa[i][1], New: fb[i][1]})
+		}
+	}
+	return ret
+}
+
+// take over what an edit may change, keep Id, Published & Authors.
+func (ent *Entry) rollbackTo(rev *Entry) {
+	r := rev.clone()
+	ent.Title = r.Title
+	ent.Content = r.Content
+	ent.Links = r.Links
+	ent.Categories = r.Categories
+	ent.MediaThumbnail = r.MediaThumbnail
+	ent.Private = r.Private
+	ent.Draft = r.Draft
+	ent.PublishAt = r.PublishAt
+}
+
+type revisionView struct {
+	Number  int
+	Updated string
+	Title   string
+	Current bool
+	Diffs   []fieldDiff // changes compared to the previous revision
+}
+
+func (app *Server) handleHistory(id Id) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		if !app.IsLoggedIn(now) {
+			http.Redirect(w, r, cgiName+"?do=login&returnurl="+url.QueryEscape(r.URL.String()), http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			app.KeepAlive(w, r, now)
+			feed, _ := LoadFeed()
+			_, ent := feed.findEntryById(id)
+			if nil == ent {
+				http.NotFound(w, r)
+				return
+			}
+			revs, err := loadRevisions(id)
+			if err != nil {
+				http.Error(w, "couldn't load revisions: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			revs = append(revs, ent)
+			views := make([]revisionView, 0, len(revs))
+			for i := len(revs) - 1; i >= 0; i-- { // newest first
+				v := revisionView{
+					Number:  i + 1,
+					Updated: time.Time(revs[i].Updated).In(app.tz).Format(time.RFC3339),
+					Title:   revs[i].Title.Body,
+					Current: i == len(revs)-1,
+				}
+				if 0 < i {
+					v.Diffs = diffEntries(revs[i-1], revs[i])
+				}
+				views = append(views, v)
+			}
+
+			byt, _ := tplHistoryHtmlBytes()
+			if tmpl, err := template.New("history").Parse(string(byt)); err == nil {
+				w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+				io.WriteString(w, xml.Header)
+				io.WriteString(w, `<?xml-stylesheet type='text/xsl' href='../../../themes/current/history.xslt'?>
+`)
+				data := map[string]interface{}{
+					"title":     app.cfg.Title,
+					"id":        id,
+					"revisions": views,
+				}
+				if err := tmpl.Execute(w, data); err != nil {
+					http.Error(w, "Coudln't render history: "+err.Error(), http.StatusInternalServerError)
+				}
+			}
+		case http.MethodPost:
+			app.KeepAlive(w, r, now)
+			unlock, err := lockFeedStorage(timeoutFeedLock)
+			if err != nil {
+				w.Header().Set("Retry-After", "10")
+				http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			defer unlock()
+			feed, _ := LoadFeed()
+			feed.XmlBase = Iri(app.url.String())
+			_, ent := feed.findEntryById(id)
+			if nil == ent {
+				http.NotFound(w, r)
+				return
+			}
+			revs, err := loadRevisions(id)
+			if err != nil {
+				http.Error(w, "couldn't load revisions: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			num, err := strconv.Atoi(r.FormValue("revision"))
+			if err != nil || num < 1 || num > len(revs) {
+				http.Error(w, "no such revision: "+r.FormValue("revision"), http.StatusBadRequest)
+				return
+			}
+			ent0 := *ent
+			ent.rollbackTo(revs[num-1])
+			ent.Updated = iso8601(now)
+			if err := saveRevision(ent0, *ent); err != nil {
+				http.Error(w, "couldn't store revision: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := app.SaveEntry(feed, ent); err != nil {
+				http.Error(w, "couldn't store feed data: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := app.PublishFeedsForModifiedEntries(feed, []*Entry{ent, &ent0}); err != nil {
+				log.Println("couldn't write feeds: ", err.Error())
+				http.Error(w, "couldn't write feeds: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "./", http.StatusFound)
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
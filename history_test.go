@@ -0,0 +1,69 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffEntries(t *testing.T) {
+	t.Parallel()
+	a := &Entry{Id: "a", Title: HumanText{Body: "A"}, Categories: []Category{{Term: "x"}}}
+	b := a.clone()
+	assert.Equal(t, 0, len(diffEntries(a, b)), "aha")
+	b.Title.Body = "B"
+	b.Content = &HumanText{Body: "more"}
+	b.Categories = append(b.Categories, Category{Term: "y"})
+	assert.Equal(t, []fieldDiff{
+		{Field: "title", Old: "A", New: "B"},
+		{Field: "content", Old: "", New: "more"},
+		{Field: "tags", Old: "#x", New: "#x #y"},
+	}, diffEntries(a, b), "aha")
+
+	b.rollbackTo(a)
+	assert.Equal(t, 0, len(diffEntries(a, b)), "rolled back")
+	assert.Equal(t, Id("a"), b.Id, "aha")
+}
+
+func TestSaveLoadRevisions(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+
+	revs, err := loadRevisions("a")
+	assert.Nil(t, err, "none yet")
+	assert.Equal(t, 0, len(revs), "aha")
+
+	e0 := Entry{Id: "a", Title: HumanText{Body: "0"}, Updated: iso8601(mustParseRFC3339("2021-01-01T00:00:00Z"))}
+	e1 := Entry{Id: "a", Title: HumanText{Body: "1"}, Updated: iso8601(mustParseRFC3339("2021-01-02T00:00:00Z"))}
+	e2 := Entry{Id: "a", Title: HumanText{Body: "2"}, Updated: iso8601(mustParseRFC3339("2021-01-03T00:00:00Z"))}
+	assert.Nil(t, saveRevision(e0, e1), "aha")
+	assert.Nil(t, saveRevision(e1, e1), "unchanged")
+	assert.Nil(t, saveRevision(e1, e2), "aha")
+
+	revs, err = loadRevisions("a")
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 2, len(revs), "aha")
+	assert.Equal(t, "0", revs[0].Title.Body, "oldest first")
+	assert.Equal(t, "1", revs[1].Title.Body, "aha")
+	_, err = os.Stat(filepath.Join(dirApp, "var", "history", "a.atom"))
+	assert.Nil(t, err, "aha")
+}
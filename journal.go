@@ -0,0 +1,206 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Append-only journal of single entry modifications.
+//
+// Creating, editing or deleting a post appends one record (a line) to
+// app/var/journal.xml and syncs. Rewriting app/var/o.atom (compacting) happens
+// only once the journal grows beyond journalCompactSize. LoadFeed replays
+// the journal on top of o.atom, so a crash or a full disk during the big
+// rewrite never loses a post.
+
+const journalCompactSize = 256 * 1024
+
+var fileFeedJournal string
+
+func init() {
+	fileFeedJournal = filepath.Join(dirApp, "var", "journal.xml")
+}
+
+type journalOp string
+
+const (
+	opPut journalOp = "put"
+	opDel journalOp = "del"
+)
+
+type journalRecord struct {
+	XMLName xml.Name  `xml:"record"`
+	Op      journalOp `xml:"op,attr"`
+	Id      Id        `xml:"id,attr"`
+	Entry   *Entry    `xml:"http://www.w3.org/2005/Atom entry,omitempty"`
+}
+
+// append the record as a single line and sync. Returns the journal size.
+func appendJournal(file string, rec journalRecord) (int64, error) {
+	defer un(trace("appendJournal"))
+	line, err := xml.Marshal(rec) // escapes newlines, so it's a single line
+	if err != nil {
+		return -1, err
+	}
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return -1, err
+	}
+	if 0 < fi.Size() {
+		// terminate a torn last record from a crash, otherwise we'd glue onto it.
+		last := []byte{0}
+		if _, err = f.ReadAt(last, fi.Size()-1); err != nil {
+			return -1, err
+		}
+		if '\n' != last[0] {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	line = append(line, '\n')
+	if _, err = f.Write(line); err != nil {
+		return -1, err
+	}
+	if err = f.Sync(); err != nil {
+		return -1, err
+	}
+	return fi.Size() + int64(len(line)), f.Close()
+}
+
+func loadJournalFile(file string) ([]journalRecord, error) {
+	defer un(trace("loadJournalFile"))
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readJournal(f)
+}
+
+// a torn (unterminated) last line from a crash gets ignored.
+func readJournal(r io.Reader) ([]journalRecord, error) {
+	ret := []journalRecord{}
+	rd := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			if 0 < len(bytes.TrimSpace(line)) {
+				log.Printf("journal: ignore torn record in line %d", lineNo)
+			}
+			return ret, nil
+		}
+		if err != nil {
+			return ret, err
+		}
+		if line = bytes.TrimSpace(line); 0 == len(line) {
+			continue
+		}
+		rec := journalRecord{}
+		if err := xml.Unmarshal(line, &rec); err != nil {
+			log.Printf("journal: ignore broken record in line %d: %s", lineNo, err)
+			continue
+		}
+		ret = append(ret, rec)
+	}
+}
+
+// apply the records in order. Idempotent, so replaying after a compaction
+// that crashed before removing the journal is harmless.
+func (feed *Feed) replay(recs []journalRecord) error {
+	if 0 == len(recs) {
+		return nil
+	}
+	for _, rec := range recs {
+		switch rec.Op {
+		case opPut:
+			if nil == rec.Entry || rec.Id != rec.Entry.Id {
+				return fmt.Errorf("journal: put without matching entry '%s'", rec.Id)
+			}
+			ent := rec.Entry.clone() // records may be cached, see serve.go
+			if idx, _ := feed.findEntryById(rec.Id); 0 <= idx {
+				feed.Entries[idx] = ent
+			} else if _, err := feed.Append(ent); err != nil {
+				return err
+			}
+		case opDel:
+			feed.deleteEntryById(rec.Id)
+		default:
+			return fmt.Errorf("journal: unknown op '%s'", rec.Op)
+		}
+	}
+	sort.Sort(ByPublishedDesc(feed.Entries))
+	return nil
+}
+
+func loadJournal() ([]journalRecord, error) {
+	if nil != memCache {
+		v, err := memCache.load(fileFeedJournal, func(file string) (interface{}, error) { return loadJournalFile(file) })
+		if err != nil {
+			return nil, err
+		}
+		return v.([]journalRecord), nil
+	}
+	return loadJournalFile(fileFeedJournal)
+}
+
+// Persist a new or modified entry. Callers hold lockFeedStorage.
+func (app Server) SaveEntry(feed Feed, ent *Entry) error {
+	return app.saveJournaled(feed, journalRecord{Op: opPut, Id: ent.Id, Entry: ent})
+}
+
+// Persist removing an entry. Callers hold lockFeedStorage.
+func (app Server) SaveDeletion(feed Feed, id Id) error {
+	return app.saveJournaled(feed, journalRecord{Op: opDel, Id: id})
+}
+
+// feed must already contain the modification.
+func (app Server) saveJournaled(feed Feed, rec journalRecord) error {
+	defer un(trace("Server.saveJournaled"))
+	before := currentStoreStat()
+	size, err := appendJournal(fileFeedJournal, rec)
+	if err != nil {
+		return err
+	}
+	if err := saveNextDue(feed); err != nil {
+		log.Printf("couldn't write %s: %s", fileNextDue, err)
+	}
+	if err := updateSearchIndex(feed, rec, before); err != nil {
+		log.Printf("couldn't update search index %s: %s", fileSearchIndex, err)
+	}
+	if size < journalCompactSize {
+		return nil
+	}
+	if err := app.SaveFeed(feed); err != nil {
+		// safe in the journal, compacting retries next time
+		log.Printf("couldn't compact journal: %s", err)
+	}
+	return nil
+}
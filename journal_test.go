@@ -0,0 +1,108 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadJournalTorn(t *testing.T) {
+	t.Parallel()
+	recs, err := readJournal(strings.NewReader(`<record op="del" id="a"></record>
+
+<record op="del" id="b"></record>
+<record op="put" id="c"><entry xmlns="http://www.w3.org/2005/Atom"><ti`))
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 2, len(recs), "torn last line ignored")
+	assert.Equal(t, Id("b"), recs[1].Id, "aha")
+	assert.Equal(t, opDel, recs[1].Op, "aha")
+}
+
+func TestFeedReplay(t *testing.T) {
+	t.Parallel()
+	pub := iso8601(mustParseRFC3339("2017-11-01T00:00:00+01:00"))
+	feed := Feed{Entries: []*Entry{{Id: "a", Published: pub}, {Id: "b", Published: pub}}}
+	recs := []journalRecord{
+		{Op: opPut, Id: "c", Entry: &Entry{Id: "c", Title: HumanText{Body: "C"}, Published: iso8601(mustParseRFC3339("2018-01-01T00:00:00+01:00"))}},
+		{Op: opPut, Id: "a", Entry: &Entry{Id: "a", Title: HumanText{Body: "A"}, Published: pub}},
+		{Op: opDel, Id: "b"},
+	}
+	assert.Nil(t, feed.replay(recs), "aha")
+	assert.Nil(t, feed.replay(recs), "idempotent")
+	assert.Equal(t, 2, len(feed.Entries), "aha")
+	assert.Equal(t, Id("c"), feed.Entries[0].Id, "sorted")
+	assert.Equal(t, "A", feed.Entries[1].Title.Body, "aha")
+	assert.False(t, recs[0].Entry == feed.Entries[0], "cloned")
+
+	assert.NotNil(t, feed.replay([]journalRecord{{Op: opPut, Id: "x"}}), "no entry")
+	assert.NotNil(t, feed.replay([]journalRecord{{Op: "foo", Id: "x"}}), "no such op")
+}
+
+func TestJournalSaveLoadCompact(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{}
+
+	// journal only, no o.atom yet
+	feed, err := LoadFeed()
+	assert.True(t, os.IsNotExist(err), "aha")
+	ent := feed.newEntry(mustParseRFC3339("2017-11-01T00:00:00+01:00"))
+	ent.Title = HumanText{Body: "Hello"}
+	ent.Content = &HumanText{Body: "line 1\nline 2"}
+	_, err = feed.Append(ent)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, ent), "aha")
+	_, err = os.Stat(fileFeedStorage)
+	assert.True(t, os.IsNotExist(err), "not compacted")
+	b, _ := ioutil.ReadFile(fileFeedJournal)
+	assert.Equal(t, 1, strings.Count(string(b), "\n"), "one line per record")
+
+	feed, err = LoadFeed()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 1, len(feed.Entries), "replayed")
+	assert.Equal(t, "line 1\nline 2", feed.Entries[0].Content.Body, "aha")
+
+	// torn write, e.g. crash or disk full
+	f, _ := os.OpenFile(fileFeedJournal, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte("<record op=\"del\" id=\""))
+	f.Close()
+	feed, err = LoadFeed()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 1, len(feed.Entries), "torn record ignored")
+
+	feed.deleteEntryById(ent.Id)
+	assert.Nil(t, app.SaveDeletion(feed, ent.Id), "aha")
+	feed, err = LoadFeed()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 0, len(feed.Entries), "deleted")
+
+	// compact
+	_, err = feed.Append(ent)
+	assert.Nil(t, app.SaveFeed(feed), "aha")
+	_, err = os.Stat(fileFeedJournal)
+	assert.True(t, os.IsNotExist(err), "compacted")
+	feed, err = LoadFeed()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 1, len(feed.Entries), "aha")
+}
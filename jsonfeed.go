@@ -0,0 +1,169 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+// JSON Feed 1.1 https://www.jsonfeed.org/version/1.1/ written as index.json
+// next to each paged index.xml, see Server.PublishFeed
+
+const jsonFeedFileName = "index.json"
+
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	Url  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	Id            string           `json:"id"`
+	Url           string           `json:"url,omitempty"`
+	ExternalUrl   string           `json:"external_url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHtml   string           `json:"content_html,omitempty"`
+	ContentText   *string          `json:"content_text,omitempty"` // if no html, but one of both is mandatory
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Language      string           `json:"language,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageUrl string           `json:"home_page_url,omitempty"`
+	FeedUrl     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	NextUrl     string           `json:"next_url,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+func jsonFeedAuthors(ps []Person) []jsonFeedAuthor {
+	ret := make([]jsonFeedAuthor, 0, len(ps))
+	for _, p := range ps {
+		ret = append(ret, jsonFeedAuthor{Name: p.Name, Url: string(p.Uri)})
+	}
+	return ret
+}
+
+func jsonFeedTime(t iso8601) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// expects a paged feed as prepared by Feed.PagedFeeds, i.e. links relative to xml:base.
+func (feed Feed) toJsonFeed() jsonFeed {
+	base := mustParseURL(string(feed.XmlBase))
+	abs := func(href string) string {
+		if "" == href {
+			return ""
+		}
+		u, err := url.Parse(href) // may come from the user, e.g. lf_image
+		if err != nil {
+			log.Printf("drop invalid url %s: %s", href, err)
+			return ""
+		}
+		return base.ResolveReference(u).String()
+	}
+	self := LinkRelSelf(feed.Links).Href
+	ret := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title.Body,
+		HomePageUrl: abs(self),
+		FeedUrl:     abs(self + jsonFeedFileName),
+		Authors:     jsonFeedAuthors(feed.Authors),
+		Language:    string(feed.XmlLang),
+		Items:       make([]jsonFeedItem, 0, len(feed.Entries)),
+	}
+	if nil != feed.Subtitle {
+		ret.Description = feed.Subtitle.Body
+	}
+	if next := LinkRel(relNext, feed.Links).Href; "" != next { // older
+		ret.NextUrl = abs(next + jsonFeedFileName)
+	}
+	for _, ent := range feed.Entries {
+		itm := jsonFeedItem{
+			Id:            string(ent.Id),
+			Url:           abs(LinkRelSelf(ent.Links).Href),
+			Title:         ent.Title.Body,
+			DatePublished: jsonFeedTime(ent.Published),
+			DateModified:  jsonFeedTime(ent.Updated),
+			Authors:       jsonFeedAuthors(ent.Authors),
+			Language:      string(ent.XmlLang),
+		}
+		for _, l := range ent.Links {
+			if "" == l.Rel {
+				itm.ExternalUrl = l.Href
+				break
+			}
+		}
+		if nil != ent.Summary {
+			itm.Summary = ent.Summary.Body
+		}
+		if nil != ent.Content && ("html" == ent.Content.Type || "xhtml" == ent.Content.Type) {
+			itm.ContentHtml = ent.Content.Body
+			if nil != ent.Content.Div {
+				itm.ContentHtml = ent.Content.Div.Body
+			}
+		} else {
+			txt := ""
+			if nil != ent.Content {
+				txt = ent.Content.Body
+			}
+			itm.ContentText = &txt
+		}
+		if nil != ent.MediaThumbnail {
+			itm.Image = abs(string(ent.MediaThumbnail.Url))
+		}
+		for _, cat := range ent.Categories {
+			itm.Tags = append(itm.Tags, cat.Term)
+		}
+		ret.Items = append(ret.Items, itm)
+	}
+	return ret
+}
+
+func (feed Feed) saveJsonFeed(dst string, mTime time.Time) error {
+	tmp := dst + "~"
+	var err error
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(feed.toJsonFeed()); err == nil {
+			if err = w.Close(); err == nil {
+				os.Chtimes(tmp, mTime, mTime)
+				return os.Rename(tmp, dst)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestToJsonFeed(t *testing.T) {
+	t.Parallel()
+	feed := Feed{
+		XmlBase: "http://example.com/sub/",
+		Title:   HumanText{Body: "My Feed"},
+		Authors: []Person{{Name: "Hu Man"}},
+		Links: []Link{
+			{Rel: relSelf, Href: "o/t/foo-1/"},
+			{Rel: relNext, Href: "o/t/foo-0/"},
+		},
+		Entries: []*Entry{{
+			Id:             "http://example.com/sub/o/p/a/",
+			Title:          HumanText{Body: "A"},
+			Published:      iso8601(mustParseRFC3339("2021-01-01T01:02:03+01:00")),
+			Links:          []Link{{Href: "http://example.org/"}, {Rel: relSelf, Href: "o/p/a/"}},
+			Categories:     []Category{{Term: "foo"}, {Term: "bar"}},
+			MediaThumbnail: &MediaThumbnail{Url: "http://example.org/a.jpg"},
+		}},
+	}
+	jf := feed.toJsonFeed()
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", jf.Version, "aha")
+	assert.Equal(t, "http://example.com/sub/o/t/foo-1/", jf.HomePageUrl, "aha")
+	assert.Equal(t, "http://example.com/sub/o/t/foo-1/index.json", jf.FeedUrl, "aha")
+	assert.Equal(t, "http://example.com/sub/o/t/foo-0/index.json", jf.NextUrl, "aha")
+	assert.Equal(t, []jsonFeedAuthor{{Name: "Hu Man"}}, jf.Authors, "aha")
+	assert.Equal(t, 1, len(jf.Items), "aha")
+	itm := jf.Items[0]
+	assert.Equal(t, "http://example.com/sub/o/p/a/", itm.Url, "aha")
+	assert.Equal(t, "http://example.org/", itm.ExternalUrl, "aha")
+	assert.Equal(t, "http://example.org/a.jpg", itm.Image, "aha")
+	assert.Equal(t, []string{"foo", "bar"}, itm.Tags, "aha")
+	assert.Equal(t, "2021-01-01T01:02:03+01:00", itm.DatePublished, "aha")
+	assert.Equal(t, "", *itm.ContentText, "mandatory")
+
+	b, err := json.Marshal(jf)
+	assert.Nil(t, err, "aha")
+	assert.Contains(t, string(b), `"content_text":""`, "aha")
+	assert.NotContains(t, string(b), "content_html", "aha")
+}
+
+func TestToJsonFeedInvalidImage(t *testing.T) {
+	t.Parallel()
+	feed := Feed{
+		XmlBase: "http://example.com/",
+		Links:   []Link{{Rel: relSelf, Href: "o/p/"}},
+		Entries: []*Entry{{Id: "a", MediaThumbnail: &MediaThumbnail{Url: "%zz"}}},
+	}
+	assert.Equal(t, "", feed.toJsonFeed().Items[0].Image, "dropped, no panic")
+	feed.Entries[0].Links = []Link{{Rel: relSelf, Href: "%zz"}}
+	assert.Equal(t, "", feed.toRss().Channel.Items[0].Link, "dropped, no panic")
+}
+
+func TestPublishFeedJson(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 1}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	for _, id := range []Id{"a", "b"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: string(id)}, Published: iso8601(mustParseRFC3339("2021-01-01T00:00:00Z"))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	b, err := ioutil.ReadFile(filepath.Join("o", "p", "index.json"))
+	assert.Nil(t, err, "aha")
+	jf := jsonFeed{}
+	assert.Nil(t, json.Unmarshal(b, &jf), "aha")
+	assert.Equal(t, 1, len(jf.Items), "paged")
+	assert.Equal(t, "http://example.com/o/p-0/index.json", jf.NextUrl, "aha")
+	_, err = os.Stat(filepath.Join("o", "p", "a", "index.json"))
+	assert.True(t, os.IsNotExist(err), "not for single entries")
+	_, err = os.Stat(filepath.Join("o", "d", "2021-01-01", "index.json"))
+	assert.Nil(t, err, "aha")
+}
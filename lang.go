@@ -0,0 +1,108 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+// language of entries for search matching, see handleSearch.
+//
+// Entry.XmlLang, falling back to Feed.XmlLang, the language setting in app/config.yaml
+// and finally defaultLanguage. New posts get it from the <html lang> of the linked
+// page or guess it from their text, see detectLanguage.
+
+var defaultLanguage = language.German
+
+// the canonical form of a BCP 47 tag, "" if it isn't one.
+func normaliseLang(str string) Lang {
+	if "" == str {
+		return ""
+	}
+	if tag, err := language.Parse(str); err == nil && language.Und != tag {
+		return Lang(tag.String())
+	}
+	return ""
+}
+
+func entryLanguage(ent *Entry, feed Feed, setting string) language.Tag {
+	for _, l := range []Lang{ent.XmlLang, feed.XmlLang, Lang(setting)} {
+		if "" == l {
+			continue
+		}
+		if tag, err := language.Parse(string(l)); err == nil && language.Und != tag {
+			return tag
+		}
+	}
+	return defaultLanguage
+}
+
+// a matcher per entry language, created on demand.
+func searchMatchers(feed Feed, setting string) func(*Entry) *search.Matcher {
+	cache := make(map[language.Tag]*search.Matcher, 3)
+	return func(ent *Entry) *search.Matcher {
+		tag := entryLanguage(ent, feed, setting)
+		m, ok := cache[tag]
+		if !ok {
+			m = search.New(tag, search.IgnoreDiacritics, search.IgnoreCase)
+			cache[tag] = m
+		}
+		return m
+	}
+}
+
+// folded, so without accents
+var stopWords = map[string]Lang{
+	// english
+	"the": "en", "and": "en", "of": "en", "to": "en", "is": "en", "that": "en", "it": "en", "for": "en",
+	"with": "en", "this": "en", "on": "en", "are": "en", "was": "en", "be": "en", "you": "en", "not": "en",
+	"have": "en", "from": "en", "by": "en", "or": "en", "as": "en", "but": "en", "what": "en",
+	// german
+	"der": "de", "die": "de", "das": "de", "und": "de", "ist": "de", "nicht": "de", "ein": "de", "eine": "de",
+	"zu": "de", "den": "de", "mit": "de", "sich": "de", "auf": "de", "fur": "de", "von": "de", "dem": "de",
+	"im": "de", "auch": "de", "es": "de", "wie": "de", "ich": "de", "sie": "de", "wir": "de", "aber": "de",
+	// french
+	"le": "fr", "la": "fr", "les": "fr", "et": "fr", "est": "fr", "un": "fr", "une": "fr", "du": "fr",
+	"de": "fr", "en": "fr", "que": "fr", "qui": "fr", "pas": "fr", "pour": "fr", "dans": "fr", "sur": "fr",
+	"ce": "fr", "il": "fr", "elle": "fr", "avec": "fr", "au": "fr", "aux": "fr", "ne": "fr", "nous": "fr",
+	"vous": "fr", "mais": "fr",
+}
+
+// guess the language by counting stop words, "" if unsure.
+func detectLanguage(txt string) Lang {
+	count := make(map[Lang]int, 3)
+	for _, w := range searchWords(txt) {
+		if l, ok := stopWords[w]; ok {
+			count[l]++
+		}
+	}
+	ret, best, tie := Lang(""), 0, false
+	for l, c := range count {
+		switch {
+		case c > best:
+			ret, best, tie = l, c, false
+		case c == best:
+			tie = true
+		}
+	}
+	if best < 2 || tie {
+		return ""
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestNormaliseLang(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, Lang("en-US"), normaliseLang("en_us"), "aha")
+	assert.Equal(t, Lang("fr"), normaliseLang("FR"), "aha")
+	assert.Equal(t, Lang(""), normaliseLang("not a language"), "aha")
+	assert.Equal(t, Lang(""), normaliseLang(""), "aha")
+}
+
+func TestEntryLanguage(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, language.French, entryLanguage(&Entry{XmlLang: "fr"}, Feed{XmlLang: "en"}, "de"), "entry")
+	assert.Equal(t, language.English, entryLanguage(&Entry{}, Feed{XmlLang: "en"}, "de"), "feed")
+	assert.Equal(t, language.French, entryLanguage(&Entry{XmlLang: "-"}, Feed{}, "fr"), "setting")
+	assert.Equal(t, defaultLanguage, entryLanguage(&Entry{}, Feed{}, ""), "default")
+
+	matcher := searchMatchers(Feed{}, "en")
+	assert.True(t, matcher(&Entry{}) == matcher(&Entry{XmlLang: "en"}), "cached")
+	assert.False(t, matcher(&Entry{}) == matcher(&Entry{XmlLang: "fr"}), "per language")
+	idx, _ := matcher(&Entry{XmlLang: "fr"}).IndexString("Ça a été l'été", "ETE")
+	assert.Equal(t, 6, idx, "ignores case and accents, byte offset")
+}
+
+func TestDetectLanguage(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, Lang("en"), detectLanguage("The quick brown fox jumps over the lazy dog and runs."), "aha")
+	assert.Equal(t, Lang("de"), detectLanguage("Der Hund läuft über die Straße und bellt."), "aha")
+	assert.Equal(t, Lang("fr"), detectLanguage("Le chat est sur la table, à côté des livres."), "aha")
+	assert.Equal(t, Lang(""), detectLanguage("Golang"), "too little")
+	assert.Equal(t, Lang(""), detectLanguage("the und"), "undecided")
+}
@@ -0,0 +1,70 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const timeoutFeedLock = 20 * time.Second
+
+var errLockTimeout = errors.New("timeout waiting for the feed storage lock")
+var errLocked = errors.New("locked")
+
+// Block until we exclusively hold the advisory lock app/var/lock or give up
+// after timeout.
+//
+// Hold it for the complete read-modify-write, i.e. LoadFeed, SaveFeed and
+// publishing, and call the returned func when done. The lock vanishes with the
+// process, so there's no stale lock to clean up.
+func lockFeedStorage(timeout time.Duration) (func(), error) {
+	defer un(trace("lockFeedStorage"))
+	dst := filepath.Join(dirApp, "var", "lock")
+	if err := os.MkdirAll(filepath.Dir(dst), 0770); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, err
+	}
+	for end := time.Now().Add(timeout); ; {
+		if err = tryLockFile(f); err == nil {
+			break
+		}
+		if err != errLocked || time.Now().After(end) {
+			f.Close()
+			if err == errLocked {
+				err = errLockTimeout
+			}
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// for the curious admin only, the lock itself is the flock.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,45 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLockFeedStorage(t *testing.T) {
+	defer prepTeardown(t)()
+
+	unlock, err := lockFeedStorage(time.Second)
+	assert.Nil(t, err, "aha")
+
+	t0 := time.Now()
+	_, err = lockFeedStorage(200 * time.Millisecond)
+	assert.Equal(t, errLockTimeout, err, "aha")
+	assert.True(t, time.Since(t0) >= 200*time.Millisecond, "waited")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+	unlock, err = lockFeedStorage(time.Second)
+	assert.Nil(t, err, "the waiter gets it")
+	unlock()
+}
@@ -0,0 +1,113 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+)
+
+// OpenSearch 1.1 description document for browsers to add the site as a search engine,
+// http://www.opensearch.org/Specifications/OpenSearch/1.1#OpenSearch_description_document
+
+const (
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+	openSearchFileName  = "opensearch.xml"
+	mimeOpenSearch      = MimeType("application/opensearchdescription+xml")
+	mimeJsonFeed        = MimeType("application/feed+json")
+	formatJsonFeed      = "jsonfeed"
+)
+
+type openSearchUrl struct {
+	Type        MimeType `xml:"type,attr"`
+	Rel         string   `xml:"rel,attr,omitempty"`
+	Template    string   `xml:"template,attr"`
+	IndexOffset *int     `xml:"indexOffset,attr,omitempty"`
+}
+
+type openSearchImage struct {
+	Height int      `xml:"height,attr"`
+	Width  int      `xml:"width,attr"`
+	Type   MimeType `xml:"type,attr"`
+	Body   string   `xml:",chardata"`
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName      string          `xml:"ShortName"`
+	Description    string          `xml:"Description"`
+	Image          openSearchImage `xml:"Image"`
+	Urls           []openSearchUrl `xml:"Url"`
+	InputEncoding  string          `xml:"InputEncoding"`
+	OutputEncoding string          `xml:"OutputEncoding"`
+}
+
+// the rel="search" link to put into feeds, relative to the xml:base.
+func (app Server) linkOpenSearch() Link {
+	return Link{Rel: relSearch, Type: mimeOpenSearch, Href: cgiName + "/search/" + openSearchFileName, Title: app.cfg.Title}
+}
+
+func (app Server) openSearchDescription() openSearchDescription {
+	abs := func(href string) string { return app.url.ResolveReference(mustParseURL(href)).String() }
+	title := app.cfg.Title
+	if "" == title {
+		title = "ShaarliGo"
+	}
+	short := []rune(title)
+	if len(short) > 16 { // max. length per spec
+		short = short[:16]
+	}
+	// our offset counts from 0
+	zero := 0
+	search := abs(cgiName+"/search/") + "?q={searchTerms}&offset={startIndex?}"
+	return openSearchDescription{
+		ShortName:   string(short),
+		Description: "Search " + title,
+		Image:       openSearchImage{Height: 16, Width: 16, Type: "image/x-icon", Body: abs("favicon.ico")},
+		Urls: []openSearchUrl{
+			{Type: "application/atom+xml", Template: search, IndexOffset: &zero},
+			{Type: mimeJsonFeed, Template: search + "&format=" + formatJsonFeed, IndexOffset: &zero},
+			{Type: mimeJson, Template: search + "&format=" + formatJson, IndexOffset: &zero},
+			{Type: mimeOpenSearch, Rel: "self", Template: abs(app.linkOpenSearch().Href)},
+		},
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+	}
+}
+
+func (app *Server) handleOpenSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.cfg.IsConfigured() {
+			http.Redirect(w, r, cgiName+"/config", http.StatusPreconditionFailed)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", string(mimeOpenSearch)+"; charset=utf-8")
+			io.WriteString(w, xml.Header)
+			enc := xml.NewEncoder(w)
+			enc.Indent("", "  ")
+			if err := enc.Encode(app.openSearchDescription()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOpenSearchDescription(t *testing.T) {
+	t.Parallel()
+	app := Server{
+		cfg: Config{Title: "A rather long title"},
+		url: *mustParseURL("http://example.com/sub/"),
+	}
+	d := app.openSearchDescription()
+	assert.Equal(t, "A rather long ti", d.ShortName, "at most 16 characters")
+	assert.Equal(t, "http://example.com/sub/favicon.ico", d.Image.Body, "aha")
+	assert.Equal(t, 4, len(d.Urls), "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q={searchTerms}&offset={startIndex?}", d.Urls[0].Template, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q={searchTerms}&offset={startIndex?}&format=jsonfeed", d.Urls[1].Template, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q={searchTerms}&offset={startIndex?}&format=json", d.Urls[2].Template, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/opensearch.xml", d.Urls[3].Template, "aha")
+
+	b, err := xml.Marshal(d)
+	assert.Nil(t, err, "aha")
+	assert.Contains(t, string(b), `<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/"><ShortName>A rather long ti</ShortName>`, "aha")
+	assert.Contains(t, string(b), `<Url type="application/atom+xml" template="http://example.com/sub/shaarligo.cgi/search/?q={searchTerms}&amp;offset={startIndex?}" indexOffset="0"></Url>`, "aha")
+
+	assert.Equal(t, Link{Rel: relSearch, Type: mimeOpenSearch, Href: "shaarligo.cgi/search/opensearch.xml", Title: "A rather long title"}, app.linkOpenSearch(), "aha")
+}
+
+func TestHandleSearchOpenSearch(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{
+		cfg: Config{LinksPerPage: 2, PwdBcrypt: "-"},
+		ses: sessions.NewSession(nil, "test"),
+		url: *mustParseURL("http://example.com/sub/"),
+	}
+	feed := Feed{}
+	for i, id := range []Id{"a", "b", "c"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: "Hello " + string(id)}, Published: iso8601(time.Date(2021, 1, 1+i, 0, 0, 0, 0, time.UTC))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.SaveFeed(feed), "aha")
+
+	w := httptest.NewRecorder()
+	app.handleSearch()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/search/?q=hello&offset=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	body := w.Body.String()
+	assert.Contains(t, body, `xmlns:opensearch="http://a9.com/-/spec/opensearch/1.1/"`, "aha")
+	assert.Equal(t, "Accept", w.Header().Get("Vary"), "Atom, too")
+	assert.Contains(t, body, "<opensearch:totalResults>3</opensearch:totalResults>", "aha")
+	assert.Contains(t, body, "<opensearch:startIndex>2</opensearch:startIndex>", "aha")
+	assert.Contains(t, body, "<opensearch:itemsPerPage>2</opensearch:itemsPerPage>", "aha")
+	ret := Feed{}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &ret), "aha")
+	assert.Equal(t, "shaarligo.cgi/search/opensearch.xml", LinkRel(relSearch, ret.Links).Href, "aha")
+
+	w = httptest.NewRecorder()
+	app.handleSearch()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/search/?q=hello&format=jsonfeed", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	assert.Equal(t, "application/feed+json; charset=utf-8", w.Header().Get("Content-Type"), "aha")
+	jf := jsonFeed{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &jf), "aha")
+	assert.Equal(t, 2, len(jf.Items), "paged")
+	assert.Equal(t, "http://example.com/sub/o/p/c/", jf.Items[0].Url, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q=hello&format=jsonfeed&offset=0", jf.FeedUrl, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q=hello&offset=0", jf.HomePageUrl, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q=hello&format=jsonfeed&offset=2", jf.NextUrl, "aha")
+
+	w = httptest.NewRecorder()
+	app.handleOpenSearch()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/search/opensearch.xml", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	assert.Equal(t, "application/opensearchdescription+xml; charset=utf-8", w.Header().Get("Content-Type"), "aha")
+}
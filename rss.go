@@ -0,0 +1,176 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// RSS 2.0 https://www.rssboard.org/rss-specification for legacy readers,
+// rss.xml next to the newest page of o/p/ and each o/t/<tag>/
+
+const rssFileName = "rss.xml"
+const mimeRss = MimeType("application/rss+xml")
+
+type rssAtomLink struct {
+	Href string   `xml:"href,attr"`
+	Rel  Relation `xml:"rel,attr"`
+	Type MimeType `xml:"type,attr"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Body        string `xml:",chardata"`
+}
+
+type rssCategory struct {
+	Domain Iri    `xml:"domain,attr,omitempty"`
+	Body   string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title          string          `xml:"title,omitempty"`
+	Link           string          `xml:"link,omitempty"`
+	Description    string          `xml:"description,omitempty"`
+	Guid           rssGuid         `xml:"guid"`
+	PubDate        string          `xml:"pubDate,omitempty"`
+	Categories     []rssCategory   `xml:"category"`
+	MediaThumbnail *MediaThumbnail `xml:"media:thumbnail,omitempty"` // https://github.com/golang/go/issues/9519#issuecomment-252196382
+	GeoRssPoint    *GeoRssPoint    `xml:"georss:point,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	Language      Lang        `xml:"language,omitempty"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Generator     string      `xml:"generator,omitempty"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rss struct {
+	XMLName     xml.Name   `xml:"rss"`
+	Version     string     `xml:"version,attr"`
+	XmlNSAtom   string     `xml:"xmlns:atom,attr"`
+	XmlNSMedia  string     `xml:"xmlns:media,attr"`
+	XmlNSGeoRss string     `xml:"xmlns:georss,attr"`
+	Channel     rssChannel `xml:"channel"`
+}
+
+// only the newest page, RSS doesn't do paging.
+func hasRss(uri string, id Id) bool {
+	if uri != string(id) {
+		return false
+	}
+	return uriPubPosts == uri || (strings.HasPrefix(uri, uriPubTags) && uriPubTags != uri)
+}
+
+func rssTime(t iso8601) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC1123Z)
+}
+
+// expects a paged feed as prepared by Feed.PagedFeeds, i.e. links relative to xml:base.
+func (feed Feed) toRss() rss {
+	base := mustParseURL(string(feed.XmlBase))
+	abs := func(href string) string {
+		u, err := url.Parse(href)
+		if err != nil {
+			log.Printf("drop invalid url %s: %s", href, err)
+			return ""
+		}
+		return base.ResolveReference(u).String()
+	}
+	self := LinkRelSelf(feed.Links).Href
+	ret := rss{
+		Version:     "2.0",
+		XmlNSAtom:   "http://www.w3.org/2005/Atom",
+		XmlNSMedia:  "http://search.yahoo.com/mrss/",
+		XmlNSGeoRss: "http://www.georss.org/georss",
+		Channel: rssChannel{
+			Title:         feed.Title.Body,
+			Link:          abs(self),
+			Description:   feed.Title.Body,
+			Language:      feed.XmlLang,
+			LastBuildDate: rssTime(feed.Updated),
+			AtomLink:      rssAtomLink{Href: abs(self + rssFileName), Rel: relSelf, Type: mimeRss},
+			Items:         make([]rssItem, 0, len(feed.Entries)),
+		},
+	}
+	if nil != feed.Subtitle {
+		ret.Channel.Description = feed.Subtitle.Body
+	}
+	if nil != feed.Generator {
+		ret.Channel.Generator = feed.Generator.Body
+	}
+	for _, ent := range feed.Entries {
+		itm := rssItem{
+			Title:          ent.Title.Body,
+			Link:           abs(LinkRelSelf(ent.Links).Href),
+			Guid:           rssGuid{IsPermaLink: true, Body: abs(LinkRelSelf(ent.Links).Href)},
+			PubDate:        rssTime(ent.Published),
+			MediaThumbnail: ent.MediaThumbnail,
+			GeoRssPoint:    ent.GeoRssPoint,
+		}
+		for _, l := range ent.Links {
+			if "" == l.Rel {
+				itm.Link = l.Href
+				break
+			}
+		}
+		if nil != ent.Content {
+			itm.Description = ent.Content.Body
+		}
+		for _, cat := range ent.Categories {
+			itm.Categories = append(itm.Categories, rssCategory{Domain: cat.Scheme, Body: cat.Term})
+		}
+		ret.Channel.Items = append(ret.Channel.Items, itm)
+	}
+	return ret
+}
+
+func (feed Feed) saveRss(dst string, mTime time.Time) error {
+	tmp := dst + "~"
+	var err error
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if _, err = w.WriteString(xml.Header); err == nil {
+			if err = enc.Encode(feed.toRss()); err == nil {
+				if err = enc.Flush(); err == nil {
+					if err = w.Close(); err == nil {
+						os.Chtimes(tmp, mTime, mTime)
+						return os.Rename(tmp, dst)
+					}
+				}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHasRss(t *testing.T) {
+	t.Parallel()
+	assert.True(t, hasRss(uriPubPosts, uriPubPosts), "aha")
+	assert.False(t, hasRss("o/p-0/", uriPubPosts), "older page")
+	assert.True(t, hasRss(uriPubTags+"foo/", uriPubTags+"foo/"), "aha")
+	assert.False(t, hasRss(uriPubTags, uriPubTags), "tag list")
+	assert.False(t, hasRss(uriPubDays+"2021-01-01/", uriPubDays+"2021-01-01/"), "no days")
+}
+
+func TestToRss(t *testing.T) {
+	t.Parallel()
+	lat := GeoRssPoint{Lat: 1.5, Lon: 2.5}
+	feed := Feed{
+		XmlBase: "http://example.com/sub/",
+		Title:   HumanText{Body: "My Feed"},
+		Links:   []Link{{Rel: relSelf, Href: "o/p/"}},
+		Entries: []*Entry{{
+			Id:             "http://example.com/sub/o/p/a/",
+			Title:          HumanText{Body: "A"},
+			Content:        &HumanText{Body: "Lorem"},
+			Published:      iso8601(mustParseRFC3339("2021-01-01T01:02:03+01:00")),
+			Links:          []Link{{Href: "http://example.org/"}, {Rel: relSelf, Href: "o/p/a/"}},
+			Categories:     []Category{{Term: "foo", Scheme: "http://example.com/sub/o/t/"}},
+			MediaThumbnail: &MediaThumbnail{Url: "http://example.org/a.jpg"},
+			GeoRssPoint:    &lat,
+		}},
+	}
+	b, err := xml.MarshalIndent(feed.toRss(), "", "  ")
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xmlns:georss="http://www.georss.org/georss">
+  <channel>
+    <title>My Feed</title>
+    <link>http://example.com/sub/o/p/</link>
+    <description>My Feed</description>
+    <atom:link href="http://example.com/sub/o/p/rss.xml" rel="self" type="application/rss+xml"></atom:link>
+    <item>
+      <title>A</title>
+      <link>http://example.org/</link>
+      <description>Lorem</description>
+      <guid isPermaLink="true">http://example.com/sub/o/p/a/</guid>
+      <pubDate>Fri, 01 Jan 2021 01:02:03 +0100</pubDate>
+      <category domain="http://example.com/sub/o/t/">foo</category>
+      <media:thumbnail url="http://example.org/a.jpg"></media:thumbnail>
+      <georss:point>1.500000 2.500000</georss:point>
+    </item>
+  </channel>
+</rss>`, string(b), "aha")
+}
+
+func TestPublishFeedRss(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 1}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	for _, id := range []Id{"a", "b"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: string(id)}, Categories: []Category{{Term: "foo"}}, Published: iso8601(mustParseRFC3339("2021-01-01T00:00:00Z"))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	for _, dir := range []string{"o/p", "o/t/foo"} {
+		_, err := os.Stat(filepath.Join(filepath.FromSlash(dir), "rss.xml"))
+		assert.Nil(t, err, dir)
+	}
+	_, err := os.Stat(filepath.Join("o", "p-0", "rss.xml"))
+	assert.True(t, os.IsNotExist(err), "only newest page")
+	b, _ := ioutil.ReadFile(filepath.Join("o", "p", "index.xml"))
+	assert.Contains(t, string(b), `<link href="o/p/rss.xml" rel="alternate" type="application/rss+xml"></link>`, "autodiscovery")
+}
+
+func TestPublishFeedRssEmptied(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	ent := &Entry{Id: "a", Title: HumanText{Body: "a"}, Categories: []Category{{Term: "foo"}}, Published: iso8601(mustParseRFC3339("2021-01-01T00:00:00Z"))}
+	_, err := feed.Append(ent)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+	_, err = os.Stat(filepath.Join("o", "t", "foo", "rss.xml"+gzSuffix))
+	assert.Nil(t, err, "aha")
+
+	ent.Private = true
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+	for _, f := range []string{"rss.xml", "rss.xml" + gzSuffix, "index.xml", "index.json"} {
+		_, err = os.Stat(filepath.Join("o", "t", "foo", f))
+		assert.True(t, os.IsNotExist(err), f)
+	}
+	_, err = os.Stat(filepath.Join("o", "t", "foo"))
+	assert.True(t, os.IsNotExist(err), "removed the directory, too")
+}
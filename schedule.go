@@ -0,0 +1,155 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Drafts are stored but not published. Drafts with a PublishAt time get
+// published by the first request after that time (see handleMux) or
+// `shaarligo.cgi publish-due`, e.g. via cron.
+//
+// To keep that check cheap, app/var/next-due.txt holds the earliest PublishAt.
+
+const fmtDateTimeLocal = "2006-01-02T15:04" // html input type datetime-local
+
+var fileNextDue string
+
+func init() {
+	fileNextDue = filepath.Join(dirApp, "var", "next-due.txt")
+}
+
+func (entry *Entry) isScheduled() bool {
+	return entry.Draft && nil != entry.PublishAt && !entry.PublishAt.IsZero()
+}
+
+func (entry *Entry) isDue(now time.Time) bool {
+	return entry.isScheduled() && !time.Time(*entry.PublishAt).After(now)
+}
+
+// earliest PublishAt of all scheduled drafts
+func (feed Feed) nextDue() (time.Time, bool) {
+	ret, ok := time.Time{}, false
+	for _, ent := range feed.Entries {
+		if !ent.isScheduled() {
+			continue
+		}
+		if t := time.Time(*ent.PublishAt); !ok || t.Before(ret) {
+			ret, ok = t, true
+		}
+	}
+	return ret, ok
+}
+
+// write or remove app/var/next-due.txt. Callers hold lockFeedStorage.
+func saveNextDue(feed Feed) error {
+	if t, ok := feed.nextDue(); ok {
+		tmp := fileNextDue + "~"
+		if err := ioutil.WriteFile(tmp, []byte(t.Format(time.RFC3339)+"\n"), 0660); err != nil {
+			return err
+		}
+		return os.Rename(tmp, fileNextDue)
+	}
+	if err := os.Remove(fileNextDue); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func loadNextDue() (time.Time, error) {
+	b, err := ioutil.ReadFile(fileNextDue)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+}
+
+// publish if app/var/next-due.txt says so.
+func (app Server) PublishDueIfAny(now time.Time) error {
+	if t, err := loadNextDue(); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	} else if t.After(now) {
+		return nil
+	}
+	_, err := app.PublishDue(now)
+	return err
+}
+
+// publish all scheduled drafts due, POSSE them and update the static feeds.
+func (app Server) PublishDue(now time.Time) ([]*Entry, error) {
+	defer un(trace("Server.PublishDue"))
+	unlock, err := lockFeedStorage(timeoutFeedLock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	feed, err := LoadFeed()
+	if err != nil {
+		return nil, err
+	}
+	due := []*Entry{}
+	for _, ent := range feed.Entries {
+		if !ent.isDue(now) {
+			continue
+		}
+		ent.Published = *ent.PublishAt
+		ent.Updated = iso8601(now)
+		ent.Draft = false
+		ent.PublishAt = nil
+		if err := app.SaveEntry(feed, ent); err != nil {
+			return due, err
+		}
+		due = append(due, ent)
+	}
+	if 0 == len(due) {
+		return due, saveNextDue(feed) // stale anyway
+	}
+	for _, ent := range due {
+		if ent.isPublic() {
+			app.Posse(*ent)
+		}
+	}
+	feed.XmlBase = Iri(app.url.String())
+	return due, app.PublishFeedsForModifiedEntries(feed, due)
+}
+
+// $ shaarligo.cgi publish-due
+func publishDue(args []string) error {
+	if 0 != len(args) {
+		return fmt.Errorf("usage: %s publish-due", filepath.Base(os.Args[0]))
+	}
+	app, err := newCliServer()
+	if err != nil {
+		return err
+	}
+	due, err := app.PublishDue(time.Now())
+	for _, ent := range due {
+		fmt.Printf("published %s %s\n", ent.Id, ent.Title.Body)
+	}
+	return err
+}
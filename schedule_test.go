@@ -0,0 +1,82 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFeedNextDue(t *testing.T) {
+	t.Parallel()
+	t0 := mustParseRFC3339("2021-01-01T00:00:00Z")
+	t1 := iso8601(t0.Add(time.Hour))
+	t2 := iso8601(t0.Add(2 * time.Hour))
+	t3 := iso8601(t0)
+	feed := Feed{Entries: []*Entry{
+		{Id: "a", Draft: true},
+		{Id: "b", Draft: true, PublishAt: &t2},
+		{Id: "c", Draft: true, PublishAt: &t1},
+		{Id: "d", PublishAt: &t3}, // not a draft
+	}}
+	due, ok := feed.nextDue()
+	assert.True(t, ok, "aha")
+	assert.Equal(t, time.Time(t1), due, "aha")
+	assert.False(t, feed.Entries[0].isPublic(), "draft")
+	assert.False(t, feed.Entries[2].isDue(t0), "not yet")
+	assert.True(t, feed.Entries[2].isDue(t0.Add(time.Hour)), "aha")
+
+	_, ok = Feed{Entries: feed.Entries[:1]}.nextDue()
+	assert.False(t, ok, "nothing scheduled")
+}
+
+func TestPublishDue(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{cfg: Config{LinksPerPage: 10}, url: *mustParseURL("http://example.com/sub/")}
+
+	t0 := mustParseRFC3339("2021-01-01T00:00:00Z")
+	at := iso8601(t0.Add(time.Hour))
+	feed := Feed{}
+	ent := &Entry{Id: "a", Title: HumanText{Body: "A"}, Published: iso8601(t0), Draft: true, PublishAt: &at}
+	_, err := feed.Append(ent)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, ent), "aha")
+	due, err := loadNextDue()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, time.Time(at).Unix(), due.Unix(), "aha")
+
+	assert.Nil(t, app.PublishDueIfAny(t0), "not yet")
+	_, err = os.Stat(filepath.Join("o", "p", "a", "index.xml"))
+	assert.True(t, os.IsNotExist(err), "not published")
+
+	assert.Nil(t, app.PublishDueIfAny(t0.Add(2*time.Hour)), "aha")
+	_, err = os.Stat(filepath.Join("o", "p", "a", "index.xml"))
+	assert.Nil(t, err, "published")
+	_, err = loadNextDue()
+	assert.True(t, os.IsNotExist(err), "nothing due anymore")
+
+	feed, _ = LoadFeed()
+	assert.False(t, feed.Entries[0].Draft, "aha")
+	assert.Nil(t, feed.Entries[0].PublishAt, "aha")
+	assert.Equal(t, time.Time(at).Unix(), time.Time(feed.Entries[0].Published).Unix(), "aha")
+}
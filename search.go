@@ -18,7 +18,9 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
@@ -27,7 +29,6 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/text/language"
 	"golang.org/x/text/search"
 )
 
@@ -88,75 +89,124 @@ func (app *Server) handleSearch() http.HandlerFunc {
 				}
 				qu := cgiName + "/search/" + "?" + "q" + "=" + url.QueryEscape(strings.Join(terms, " "))
 
-				catScheme := Iri(app.url.ResolveReference(mustParseURL(path.Join(uriPub, uriTags))).String() + "/")
+				sq, err := parseSearchQuery(strings.Join(terms, " "))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 
+				st := currentStoreStat() // before loading, see loadSearchIndexFor
 				feed, _ := LoadFeed()
+				feed.Entries = loadSearchIndexFor(feed, st).Candidates(feed.Entries, sq.indexTerms())
+				if !app.IsLoggedIn(now) {
+					feed.Entries = publicEntries(feed.Entries)
+				}
 
-				lang := language.Make("de") // todo: should come from the entry, feed, settings, default (in that order)
-				matcher := search.New(lang, search.IgnoreDiacritics, search.IgnoreCase)
-				ret := feed.Search(func(entry *Entry) int { return rankEntryTerms(entry, terms, matcher) })
+				matcher := searchMatchers(feed, app.cfg.Language)
+				ret := feed.Search(func(entry *Entry) int { return sq.rank(entry, matcher(entry)) })
+				w.Header().Add("Vary", "Accept") // see wantsSearchJson
+				if wantsSearchJson(r) {
+					app.serveSearchJson(w, ret.Entries, strings.Join(terms, " "), sq, matcher, qu, offset, limit)
+					return
+				}
 
 				ret.XmlBase = Iri(app.url.String())
 				ret.Id = Id(app.url.ResolveReference(mustParseURL(qu)).String())
 				ret.Generator = &Generator{Uri: myselfNamespace, Version: version, Body: "🌺 ShaarliGo"}
 				ret.XmlNSShaarliGo = myselfNamespace
 				ret.SearchTerms = strings.Join(q, " ") // rather use http://www.opensearch.org/Specifications/OpenSearch/1.1#Example_of_OpenSearch_response_elements_in_Atom_1.0
-				ret.XmlNSOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
-
-				// paging / RFC5005
-				clamp := func(x int) int { return min(len(ret.Entries), x) }
-				offset = clamp(max(0, offset))
-				count := len(ret.Entries)
-				ret.Links = append(ret.Links, Link{Rel: relSelf, Href: qu + "&" + "offset" + "=" + strconv.Itoa(offset), Title: strconv.Itoa(1 + offset/limit)})
-				if count > limit {
-					ret.Links = append(ret.Links, Link{Rel: relFirst, Href: qu, Title: strconv.Itoa(1 + 0)})
-					ret.Links = append(ret.Links, Link{Rel: relLast, Href: qu + "&" + "offset" + "=" + strconv.Itoa(count-(count%limit)), Title: strconv.Itoa(1 + count/limit)})
-					if intPrev := offset - limit; intPrev >= 0 {
-						ret.Links = append(ret.Links, Link{Rel: relPrevious, Href: qu + "&" + "offset" + "=" + strconv.Itoa(intPrev), Title: strconv.Itoa(1 + intPrev/limit)})
-					}
-					if intNext := offset + limit; intNext < count {
-						ret.Links = append(ret.Links, Link{Rel: relNext, Href: qu + "&" + "offset" + "=" + strconv.Itoa(intNext), Title: strconv.Itoa(1 + intNext/limit)})
-					}
-					ret.Entries = ret.Entries[offset:clamp(offset+limit)]
-				}
-				// prepare entries for Atom publication
-				for _, item := range ret.Entries {
-					// change entries for output but don't save the change:
-					selfURL := mustParseURL(path.Join(uriPub, uriPosts, string(item.Id)) + "/")
-					editURL := strings.Join([]string{cgiName, "?post=", selfURL.String()}, "")
-					item.Id = Id(app.url.ResolveReference(selfURL).String()) // expand XmlBase as required by https://validator.w3.org/feed/check.cgi?url=
-					item.Links = append(item.Links,
-						Link{Rel: relSelf, Href: selfURL.String()},
-						Link{Rel: relEdit, Href: editURL},
-					)
-					for i := range item.Categories {
-						item.Categories[i].Scheme = catScheme
-					}
-					if item.Updated.IsZero() {
-						item.Updated = item.Published
-					}
-					if item.Updated.After(ret.Updated) {
-						ret.Updated = item.Updated
-					}
-				}
-				ret.Categories = AggregateCategories(ret.Entries)
-				if ret.Updated.IsZero() {
-					ret.Updated = iso8601(now)
-				}
 
-				w.Header().Set("Content-Type", "text/xml; charset=utf-8")
-				enc := xml.NewEncoder(w)
-				enc.Indent("", "  ")
-				if err := xmlEncodeWithXslt(ret, "../../themes/current/posts.xslt", enc); err == nil {
-					if err := enc.Flush(); err == nil {
-						return
-					}
-				}
+				app.serveDynamicFeed(w, r, ret, qu, offset, limit, now)
 			}
 		}
 	}
 }
 
+// page, prepare and write a feed computed on request like search results,
+// qu being its url without offset. Paging per RFC5005 like the static feeds.
+//
+// As JSON Feed if asked for by the parameter format=jsonfeed.
+func (app *Server) serveDynamicFeed(w http.ResponseWriter, r *http.Request, ret Feed, qu string, offset, limit int, now time.Time) {
+	catScheme := Iri(app.url.ResolveReference(mustParseURL(path.Join(uriPub, uriTags))).String() + "/")
+	quAtom := qu
+	asJsonFeed := formatJsonFeed == r.URL.Query().Get("format")
+	if asJsonFeed {
+		qu += "&" + "format" + "=" + formatJsonFeed
+	}
+
+	// paging / RFC5005
+	clamp := func(x int) int { return min(len(ret.Entries), x) }
+	offset = clamp(max(0, offset))
+	count := len(ret.Entries)
+	ret.XmlNSOpenSearch = openSearchNamespace
+	ret.TotalResults, ret.StartIndex, ret.ItemsPerPage = &count, &offset, &limit
+	ret.Links = append(ret.Links, Link{Rel: relSelf, Href: qu + "&" + "offset" + "=" + strconv.Itoa(offset), Title: strconv.Itoa(1 + offset/limit)})
+	ret.Links = append(ret.Links, app.linkOpenSearch())
+	if count > limit {
+		ret.Links = append(ret.Links, Link{Rel: relFirst, Href: qu, Title: strconv.Itoa(1 + 0)})
+		last := limit * ((count - 1) / limit) // not past the end if count is a multiple of limit
+		ret.Links = append(ret.Links, Link{Rel: relLast, Href: qu + "&" + "offset" + "=" + strconv.Itoa(last), Title: strconv.Itoa(1 + last/limit)})
+		if intPrev := offset - limit; intPrev >= 0 {
+			ret.Links = append(ret.Links, Link{Rel: relPrevious, Href: qu + "&" + "offset" + "=" + strconv.Itoa(intPrev), Title: strconv.Itoa(1 + intPrev/limit)})
+		}
+		if intNext := offset + limit; intNext < count {
+			ret.Links = append(ret.Links, Link{Rel: relNext, Href: qu + "&" + "offset" + "=" + strconv.Itoa(intNext), Title: strconv.Itoa(1 + intNext/limit)})
+		}
+		ret.Entries = ret.Entries[offset:clamp(offset+limit)]
+	}
+	// prepare entries for Atom publication
+	for _, item := range ret.Entries {
+		// change entries for output but don't save the change:
+		selfURL := mustParseURL(path.Join(uriPub, uriPosts, string(item.Id)) + "/")
+		editURL := strings.Join([]string{cgiName, "?post=", selfURL.String()}, "")
+		item.Id = Id(app.url.ResolveReference(selfURL).String()) // expand XmlBase as required by https://validator.w3.org/feed/check.cgi?url=
+		item.Links = append(item.Links,
+			Link{Rel: relSelf, Href: selfURL.String()},
+			Link{Rel: relEdit, Href: editURL},
+		)
+		for i := range item.Categories {
+			item.Categories[i].Scheme = catScheme
+		}
+		if item.Updated.IsZero() {
+			item.Updated = item.Published
+		}
+		if item.Updated.After(ret.Updated) {
+			ret.Updated = item.Updated
+		}
+	}
+	ret.Categories = AggregateCategories(ret.Entries)
+	if ret.Updated.IsZero() {
+		ret.Updated = iso8601(now)
+	}
+
+	if asJsonFeed {
+		abs := func(href string) string { return app.url.ResolveReference(mustParseURL(href)).String() }
+		jf := ret.toJsonFeed()
+		jf.HomePageUrl = abs(quAtom + "&" + "offset" + "=" + strconv.Itoa(offset))
+		jf.FeedUrl = abs(LinkRelSelf(ret.Links).Href)
+		jf.NextUrl = ""
+		if next := LinkRel(relNext, ret.Links).Href; "" != next {
+			jf.NextUrl = abs(next)
+		}
+		w.Header().Set("Content-Type", string(mimeJsonFeed)+"; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(jf); err != nil {
+			log.Printf("couldn't write %s: %s", qu, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := xmlEncodeWithXslt(ret, "../../themes/current/posts.xslt", enc); err == nil {
+		if err := enc.Flush(); err == nil {
+			return
+		}
+	}
+}
+
 func min(x, y int) int {
 	if x < y {
 		return x
@@ -0,0 +1,340 @@
+//
+// Copyright (C) 2018-2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Inverted index of trigrams of folded words for candidate selection before ranking,
+// see handleSearch.
+//
+// Covers title, content, tags and the host of the link. Updated incrementally
+// by saveJournaled, rebuilt by SaveFeed and whenever missing or stale.
+//
+// Candidates must include whatever the search.Matcher in rankEntryTerms accepts,
+// so searchFold also expands ligatures and ß, and a query word matching inside a
+// longer word is found via its trigrams.
+
+var fileSearchIndex string
+
+func init() {
+	fileSearchIndex = filepath.Join(dirApp, "var", "search.gob.gz")
+}
+
+// shorter words can't be looked up, see searchIndex.lookup
+const searchGramLen = 3
+
+type searchIndex struct {
+	Grams   map[string][]Id // trigram -> sorted entry ids
+	Docs    map[Id][]string // entry id -> its trigrams, to update incrementally
+	Mirrors storeStat       // of the storage indexed, see loadSearchIndexFor
+}
+
+// size and mtime of the Atom file and the journal, zero if missing.
+type storeStat struct {
+	AtomSize       int64
+	AtomModTime    int64 // UnixNano
+	JournalSize    int64
+	JournalModTime int64
+}
+
+func currentStoreStat() storeStat {
+	ret := storeStat{}
+	if fi, err := os.Stat(fileFeedStorage); err == nil {
+		ret.AtomSize, ret.AtomModTime = fi.Size(), fi.ModTime().UnixNano()
+	}
+	if fi, err := os.Stat(fileFeedJournal); err == nil {
+		ret.JournalSize, ret.JournalModTime = fi.Size(), fi.ModTime().UnixNano()
+	}
+	return ret
+}
+
+func newSearchIndex() searchIndex {
+	return searchIndex{
+		Grams: make(map[string][]Id, 10000),
+		Docs:  make(map[Id][]string, 100),
+	}
+}
+
+func buildSearchIndex(entries []*Entry) searchIndex {
+	defer un(trace("buildSearchIndex"))
+	idx := newSearchIndex()
+	for _, ent := range entries {
+		idx.put(ent)
+	}
+	return idx
+}
+
+// what collation regards as equal letters but fold keeps apart.
+var searchExpand = strings.NewReplacer(
+	"ß", "ss",
+	"œ", "oe",
+	"æ", "ae",
+	"ø", "o",
+	"đ", "d",
+	"ð", "d",
+	"ł", "l",
+	"ı", "i",
+	"ħ", "h",
+)
+
+// fold plus compatibility decomposition (e.g. the ligature ﬁ) and searchExpand.
+func searchFold(str string) string {
+	return searchExpand.Replace(fold(norm.NFKC.String(str)))
+}
+
+// folded words, i.e. runs of letters and digits.
+func searchWords(str string) []string {
+	return strings.FieldsFunc(searchFold(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func wordGrams(word string) []string {
+	rs := []rune(word)
+	ret := make([]string, 0, len(rs))
+	for i := 0; i+searchGramLen <= len(rs); i++ {
+		ret = append(ret, string(rs[i:i+searchGramLen]))
+	}
+	return ret
+}
+
+// the distinct trigrams of the words to find an entry by.
+func searchGrams(ent *Entry) []string {
+	ret := make([]string, 0, 200)
+	seen := make(map[string]struct{}, 200)
+	add := func(words ...string) {
+		for _, w := range words {
+			for _, g := range wordGrams(w) {
+				if _, ok := seen[g]; ok {
+					continue
+				}
+				seen[g] = struct{}{}
+				ret = append(ret, g)
+			}
+		}
+	}
+	add(searchWords(ent.Title.Body)...)
+	if nil != ent.Content {
+		add(searchWords(ent.Content.Body)...)
+	}
+	for _, cat := range ent.Categories {
+		add(searchWords(cat.Term)...)
+	}
+	if len(ent.Links) > 0 {
+		if u, err := url.Parse(ent.Links[0].Href); err == nil && "" != u.Host {
+			add(searchWords(u.Hostname())...)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (idx searchIndex) put(ent *Entry) {
+	idx.del(ent.Id)
+	grams := searchGrams(ent)
+	idx.Docs[ent.Id] = grams
+	for _, g := range grams {
+		ids := idx.Grams[g]
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= ent.Id })
+		ids = append(ids, "")
+		copy(ids[i+1:], ids[i:])
+		ids[i] = ent.Id
+		idx.Grams[g] = ids
+	}
+}
+
+func (idx searchIndex) del(id Id) {
+	for _, g := range idx.Docs[id] {
+		ids := idx.Grams[g]
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+		if i < len(ids) && ids[i] == id {
+			ids = append(ids[:i], ids[i+1:]...)
+		}
+		if 0 == len(ids) {
+			delete(idx.Grams, g)
+		} else {
+			idx.Grams[g] = ids
+		}
+	}
+	delete(idx.Docs, id)
+}
+
+// ids of entries with words containing all words of the term, as the matcher in
+// rankEntryTerms accepts them. ok is false if the term has no word long enough
+// to look up.
+func (idx searchIndex) lookup(term string) (ret map[Id]struct{}, ok bool) {
+	for _, w := range searchWords(strings.TrimPrefix(term, "#")) {
+		for _, g := range wordGrams(w) {
+			ids := idx.Grams[g]
+			hits := make(map[Id]struct{}, len(ids))
+			for _, id := range ids {
+				if _, ok := ret[id]; ok || nil == ret {
+					hits[id] = struct{}{}
+				}
+			}
+			ret = hits
+		}
+	}
+	return ret, nil != ret
+}
+
+// the entries possibly matching any group of terms, i.e. all terms of the group,
+// in their original order. All entries if a group has no term that can be looked up.
+func (idx searchIndex) Candidates(entries []*Entry, groups [][]string) []*Entry {
+	defer un(trace("searchIndex.Candidates"))
+	all := make(map[Id]struct{}, 100)
+	for _, terms := range groups {
+		var grp map[Id]struct{}
+		for _, term := range terms {
+			ids, ok := idx.lookup(term)
+			if !ok {
+				continue // narrows nothing
+			}
+			if nil != grp {
+				for id := range grp {
+					if _, ok := ids[id]; !ok {
+						delete(grp, id)
+					}
+				}
+			} else {
+				grp = ids
+			}
+		}
+		if nil == grp {
+			return entries
+		}
+		for id := range grp {
+			all[id] = struct{}{}
+		}
+	}
+	ret := make([]*Entry, 0, len(all))
+	for _, ent := range entries {
+		if _, ok := all[ent.Id]; ok {
+			ret = append(ret, ent)
+		}
+	}
+	return ret
+}
+
+// the index for the feed as loaded after taking st, rebuilt if missing or not
+// mirroring the storage, e.g. after a failed updateSearchIndex. Searching doesn't
+// hold lockFeedStorage, so a rebuild only gets saved if the lock is free right
+// away and the storage is still as of st.
+func loadSearchIndexFor(feed Feed, st storeStat) searchIndex {
+	idx, err := loadSearchIndex(fileSearchIndex)
+	if err == nil && idx.Mirrors == st && len(idx.Docs) == len(feed.Entries) {
+		return idx
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("ignore search index %s: %s", fileSearchIndex, err)
+	}
+	idx = buildSearchIndex(feed.Entries)
+	idx.Mirrors = st
+	if unlock, err := lockFeedStorage(0); err == nil {
+		defer unlock()
+		if currentStoreStat() == st {
+			if err := idx.saveToFile(fileSearchIndex); err != nil {
+				log.Printf("couldn't write search index %s: %s", fileSearchIndex, err)
+			}
+		}
+	}
+	return idx
+}
+
+// rebuild after rewriting the storage, see SaveFeed.
+func saveSearchIndex(feed Feed) error {
+	idx := buildSearchIndex(feed.Entries)
+	idx.Mirrors = currentStoreStat()
+	return idx.saveToFile(fileSearchIndex)
+}
+
+func loadSearchIndex(file string) (searchIndex, error) {
+	defer un(trace("loadSearchIndex"))
+	idx := searchIndex{}
+	f, err := os.Open(file)
+	if err != nil {
+		return idx, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return idx, err
+	}
+	defer gz.Close()
+	if err = gob.NewDecoder(gz).Decode(&idx); err == nil && (nil == idx.Grams || nil == idx.Docs) {
+		err = fmt.Errorf("incomplete search index")
+	}
+	return idx, err
+}
+
+// write atomically via a unique tmp file and rename, like saveFeedSnapshot.
+func (idx searchIndex) saveToFile(file string) error {
+	defer un(trace("searchIndex.saveToFile"))
+	if err := os.MkdirAll(filepath.Dir(file), newDirPerms); err != nil {
+		return err
+	}
+	w, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+"~*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(w.Name()) // gone anyway if renamed
+	defer w.Close()           // just to be sure
+	gz := gzip.NewWriter(w)
+	if err = gob.NewEncoder(gz).Encode(idx); err == nil {
+		if err = gz.Close(); err == nil {
+			if err = w.Close(); err == nil {
+				return os.Rename(w.Name(), file)
+			}
+		}
+	}
+	return err
+}
+
+// apply a single modification, the feed and the journal already containing it.
+// Rebuilds if the index didn't mirror the storage as it was before, see saveJournaled.
+func updateSearchIndex(feed Feed, rec journalRecord, before storeStat) error {
+	idx, err := loadSearchIndex(fileSearchIndex)
+	if err != nil || idx.Mirrors != before {
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("ignore search index %s: %s", fileSearchIndex, err)
+		}
+		return saveSearchIndex(feed)
+	}
+	switch rec.Op {
+	case opPut:
+		idx.put(rec.Entry)
+	case opDel:
+		idx.del(rec.Id)
+	}
+	idx.Mirrors = currentStoreStat()
+	return idx.saveToFile(fileSearchIndex)
+}
@@ -0,0 +1,194 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+func TestSearchWords(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []string{"grusse", "aus", "koln", "strasse", "oeuvre", "fin", "2021"}, searchWords("Grüsse aus Köln: Straße, Œuvre ﬁn 2021."), "expanded like collation")
+}
+
+func TestSearchGrams(t *testing.T) {
+	t.Parallel()
+	ent := &Entry{
+		Title:      HumanText{Body: "Köln"},
+		Content:    &HumanText{Body: "Dom, 2021."},
+		Categories: []Category{{Term: "Städte"}},
+		Links:      []Link{{Href: "https://www.Example.com/a?b=c"}},
+	}
+	assert.Equal(t, []string{"021", "202", "adt", "amp", "com", "dom", "dte", "exa", "kol", "mpl", "oln", "ple", "sta", "tad", "www", "xam"}, searchGrams(ent), "sorted, distinct")
+	assert.Equal(t, []string{}, searchGrams(&Entry{}), "aha")
+}
+
+func TestSearchIndexCandidates(t *testing.T) {
+	t.Parallel()
+	a := &Entry{Id: "a", Title: HumanText{Body: "Über Golang"}, Categories: []Category{{Term: "programming"}}}
+	b := &Entry{Id: "b", Title: HumanText{Body: "Rust"}, Content: &HumanText{Body: "not golang"}}
+	c := &Entry{Id: "c", Title: HumanText{Body: "Python"}, Links: []Link{{Href: "http://python.org/"}}}
+	all := []*Entry{a, b, c}
+	idx := buildSearchIndex(all)
+
+	assert.Equal(t, []*Entry{a, b}, idx.Candidates(all, [][]string{{"lang"}}), "substrings, too")
+	assert.Equal(t, []*Entry{a}, idx.Candidates(all, [][]string{{"#gram"}}), "tag")
+	assert.Equal(t, []*Entry{a}, idx.Candidates(all, [][]string{{"uber"}}), "folded")
+	assert.Equal(t, []*Entry{b}, idx.Candidates(all, [][]string{{"not-golang"}}), "all words of a term")
+	assert.Equal(t, []*Entry{a, c}, idx.Candidates(all, [][]string{{"über"}, {"python.org"}}), "any group")
+	assert.Equal(t, []*Entry{b}, idx.Candidates(all, [][]string{{"golang", "rust"}}), "all terms of a group")
+	assert.Equal(t, []*Entry{b}, idx.Candidates(all, [][]string{{"go", "rust"}}), "short terms narrow nothing")
+	assert.Equal(t, all, idx.Candidates(all, [][]string{{"java"}, {}}), "group without terms")
+	assert.Equal(t, []*Entry{}, idx.Candidates(all, [][]string{{"java"}}), "none")
+	assert.Equal(t, all, idx.Candidates(all, [][]string{{"+++"}}), "no words, no index")
+	assert.Equal(t, all, idx.Candidates(all, [][]string{{"go"}}), "too short, no index")
+
+	idx.del("a")
+	assert.Equal(t, []*Entry{b}, idx.Candidates(all, [][]string{{"golang"}}), "deleted")
+	b.Title.Body = "Java"
+	b.Content = nil
+	idx.put(b)
+	assert.Equal(t, []*Entry{}, idx.Candidates(all, [][]string{{"golang"}}), "updated")
+	assert.Equal(t, []*Entry{b}, idx.Candidates(all, [][]string{{"java"}}), "updated")
+	assert.Equal(t, 2, len(idx.Docs), "aha")
+	_, ok := idx.Grams["rus"]
+	assert.False(t, ok, "no stale grams")
+}
+
+// whatever the ranker finds must be a candidate.
+func TestSearchIndexCandidatesSupersetOfMatcher(t *testing.T) {
+	t.Parallel()
+	all := []*Entry{
+		{Id: "a", Title: HumanText{Body: "Un chef-d'œuvre"}},
+		{Id: "b", Title: HumanText{Body: "Hauptstraße"}},
+		{Id: "c", Title: HumanText{Body: "ﬁnal Æon"}},
+		{Id: "d", Title: HumanText{Body: "oeuvre, strasse, final, aeon"}},
+	}
+	idx := buildSearchIndex(all)
+	for _, lang := range []language.Tag{language.English, language.French, language.German} {
+		matcher := search.New(lang, search.IgnoreDiacritics, search.IgnoreCase)
+		for _, q := range []string{"oeuvre", "œuvre", "strasse", "straße", "STRASSE", "final", "ﬁnal", "aeon", "æon"} {
+			cand := idx.Candidates(all, [][]string{{q}})
+			for _, ent := range all {
+				if rankEntryTerms(ent, []string{q}, matcher) > 0 {
+					assert.Contains(t, cand, ent, lang.String()+" "+q+" "+string(ent.Id))
+				}
+			}
+		}
+	}
+	assert.Equal(t, []*Entry{all[0], all[3]}, idx.Candidates(all, [][]string{{"oeuvre"}}), "aha")
+	assert.Equal(t, []*Entry{all[1], all[3]}, idx.Candidates(all, [][]string{{"strasse"}}), "aha")
+}
+
+func TestSearchIndexSaveJournaled(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{}
+	feed := Feed{}
+	a := &Entry{Id: "a", Title: HumanText{Body: "Hello"}}
+	_, err := feed.Append(a)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, a), "aha")
+
+	idx, err := loadSearchIndex(fileSearchIndex)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, []Id{"a"}, idx.Grams["llo"], "aha")
+
+	b := &Entry{Id: "b", Title: HumanText{Body: "Hello World"}}
+	_, err = feed.Append(b)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, b), "aha")
+	feed.deleteEntryById("a")
+	assert.Nil(t, app.SaveDeletion(feed, "a"), "aha")
+
+	idx = loadSearchIndexFor(feed, currentStoreStat())
+	assert.Equal(t, []Id{"b"}, idx.Grams["llo"], "aha")
+	assert.Equal(t, []Id{"b"}, idx.Grams["wor"], "aha")
+	assert.Equal(t, 1, len(idx.Docs), "aha")
+}
+
+func TestSearchIndexStale(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{}
+	feed := Feed{}
+	a := &Entry{Id: "a", Title: HumanText{Body: "Hello"}}
+	_, err := feed.Append(a)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, a), "aha")
+
+	// an edit the index missed, e.g. as updating it failed
+	a.Title.Body = "Servus"
+	_, err = appendJournal(fileFeedJournal, journalRecord{Op: opPut, Id: a.Id, Entry: a})
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, []*Entry{a}, loadSearchIndexFor(feed, currentStoreStat()).Candidates(feed.Entries, [][]string{{"servus"}}), "rebuilt")
+
+	// again, but then a successful incremental update
+	a.Title.Body = "Moin"
+	_, err = appendJournal(fileFeedJournal, journalRecord{Op: opPut, Id: a.Id, Entry: a})
+	assert.Nil(t, err, "aha")
+	b := &Entry{Id: "b", Title: HumanText{Body: "Hello"}}
+	_, err = feed.Append(b)
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveEntry(feed, b), "aha")
+	idx, err := loadSearchIndex(fileSearchIndex)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, []*Entry{a}, idx.Candidates(feed.Entries, [][]string{{"moin"}}), "rebuilt, not patched")
+	assert.Equal(t, currentStoreStat(), idx.Mirrors, "aha")
+}
+
+func TestSearchIndexRebuildNotSaved(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	feed := Feed{}
+	a := &Entry{Id: "a", Title: HumanText{Body: "Hello"}}
+	_, err := feed.Append(a)
+	assert.Nil(t, err, "aha")
+	_, err = appendJournal(fileFeedJournal, journalRecord{Op: opPut, Id: a.Id, Entry: a})
+	assert.Nil(t, err, "aha")
+
+	// a post landing between taking the stat and loading the feed
+	st := currentStoreStat()
+	_, err = appendJournal(fileFeedJournal, journalRecord{Op: opPut, Id: "b", Entry: &Entry{Id: "b"}})
+	assert.Nil(t, err, "aha")
+	idx := loadSearchIndexFor(feed, st)
+	assert.Equal(t, st, idx.Mirrors, "aha")
+	_, err = os.Stat(fileSearchIndex)
+	assert.True(t, os.IsNotExist(err), "storage changed meanwhile")
+
+	// somebody else saving
+	unlock, err := lockFeedStorage(timeoutFeedLock)
+	assert.Nil(t, err, "aha")
+	loadSearchIndexFor(feed, currentStoreStat())
+	_, err = os.Stat(fileSearchIndex)
+	assert.True(t, os.IsNotExist(err), "locked")
+	unlock()
+
+	loadSearchIndexFor(feed, currentStoreStat())
+	idx, err = loadSearchIndex(fileSearchIndex)
+	assert.Nil(t, err, "saved")
+	assert.Equal(t, currentStoreStat(), idx.Mirrors, "aha")
+	matches, _ := filepath.Glob(fileSearchIndex + "~*")
+	assert.Equal(t, 0, len(matches), "no tmp files left")
+}
@@ -0,0 +1,248 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/search"
+)
+
+// Search results as plain JSON for scripts like browser extensions, asked for by
+// format=json or Accept: application/json, see handleSearch.
+//
+// Highlights are [start, end) ranges in characters (runes) of the snippet.
+
+const (
+	formatJson    = "json"
+	mimeJson      = MimeType("application/json")
+	snippetBefore = 40  // context before the first hit
+	snippetLength = 160 // at most
+	ellipsis      = "…"
+)
+
+type searchHighlight [2]int
+
+type searchMatch struct {
+	Field      string            `json:"field"` // title, content, tags or link
+	Snippet    string            `json:"snippet"`
+	Highlights []searchHighlight `json:"highlights"`
+}
+
+type searchResult struct {
+	Id        string        `json:"id"`
+	Url       string        `json:"url"`
+	Link      string        `json:"link,omitempty"`
+	Title     string        `json:"title"`
+	Published string        `json:"published,omitempty"`
+	Tags      []string      `json:"tags,omitempty"`
+	Rank      int           `json:"rank"`
+	Matches   []searchMatch `json:"matches"`
+}
+
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+	Next    string         `json:"next,omitempty"`
+	Results []searchResult `json:"results"`
+}
+
+func wantsSearchJson(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); "" != f {
+		return formatJson == f
+	}
+	return strings.Contains(r.Header.Get("Accept"), string(mimeJson))
+}
+
+// byte ranges of all occurrences of the terms, sorted and merged.
+func matchRanges(txt string, terms []string, matcher *search.Matcher) [][2]int {
+	ret := make([][2]int, 0, 10)
+	for _, term := range terms {
+		for off := 0; off < len(txt); {
+			start, end := matcher.IndexString(txt[off:], term)
+			if start < 0 || end <= start {
+				break
+			}
+			ret = append(ret, [2]int{off + start, off + end})
+			off += end
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i][0] < ret[j][0] })
+	merged := ret[:0]
+	for _, r := range ret {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// a window of txt around the first of the byte ranges, with the ranges inside
+// converted to runes of the snippet.
+func snippet(txt string, ranges [][2]int) searchMatch {
+	rs := []rune(txt)
+	runeAt := func(b int) int { return utf8.RuneCountInString(txt[:b]) }
+	from := 0
+	if len(ranges) > 0 {
+		from = max(0, runeAt(ranges[0][0])-snippetBefore)
+	}
+	to := min(len(rs), from+snippetLength)
+	ret := searchMatch{Snippet: string(rs[from:to]), Highlights: []searchHighlight{}}
+	shift := -from
+	if from > 0 {
+		ret.Snippet = ellipsis + ret.Snippet
+		shift += utf8.RuneCountInString(ellipsis)
+	}
+	if to < len(rs) {
+		ret.Snippet += ellipsis
+	}
+	for _, r := range ranges {
+		if s, e := runeAt(r[0]), runeAt(r[1]); from <= s && e <= to {
+			ret.Highlights = append(ret.Highlights, searchHighlight{s + shift, e + shift})
+		}
+	}
+	return ret
+}
+
+// the fields matching the query's terms, with the hits highlighted.
+func (q searchQuery) matches(ent *Entry, matcher *search.Matcher) []searchMatch {
+	words := make([]string, 0, 10)
+	tags := make([]func(string) bool, 0, 10)
+	sites := make([]string, 0, 2)
+	for _, grp := range q {
+		for _, t := range grp {
+			if t.Not {
+				continue
+			}
+			switch t.Field {
+			case "":
+				words = append(words, t.Value)
+				if strings.HasPrefix(t.Value, "#") {
+					v := t.Value[1:]
+					tags = append(tags, func(term string) bool { idx, _ := matcher.IndexString(term, v); return idx >= 0 })
+				}
+			case fieldTag:
+				v := fold(t.Value)
+				tags = append(tags, func(term string) bool { return fold(term) == v })
+			case fieldSite:
+				sites = append(sites, t.Value)
+			}
+		}
+	}
+
+	ret := make([]searchMatch, 0, 4)
+	text := func(field, txt string) {
+		if ranges := matchRanges(txt, words, matcher); len(ranges) > 0 {
+			m := snippet(txt, ranges)
+			m.Field = field
+			ret = append(ret, m)
+		}
+	}
+	text("title", ent.Title.Body)
+	if nil != ent.Content {
+		text("content", ent.Content.Body)
+	}
+
+	m := searchMatch{Field: "tags", Highlights: []searchHighlight{}}
+	for i, cat := range ent.Categories {
+		if i > 0 {
+			m.Snippet += " "
+		}
+		start := utf8.RuneCountInString(m.Snippet)
+		m.Snippet += "#" + cat.Term
+		for _, match := range tags {
+			if match(cat.Term) {
+				m.Highlights = append(m.Highlights, searchHighlight{start, utf8.RuneCountInString(m.Snippet)})
+				break
+			}
+		}
+	}
+	if len(m.Highlights) > 0 {
+		ret = append(ret, m)
+	}
+
+	if len(ent.Links) > 0 {
+		href := ent.Links[0].Href
+		for _, site := range sites {
+			if u, err := url.Parse(href); err == nil && hostMatches(href, site) {
+				m := searchMatch{Field: "link", Snippet: href, Highlights: []searchHighlight{}}
+				// not found if percent-encoded, e.g. http://%E4%BE%8B.jp/
+				if i := strings.Index(href, u.Host); i >= 0 {
+					start := utf8.RuneCountInString(href[:i])
+					m.Highlights = append(m.Highlights, searchHighlight{start, start + utf8.RuneCountInString(u.Host)})
+				}
+				ret = append(ret, m)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// write the page of ranked entries as JSON, qu being the search url without offset.
+func (app *Server) serveSearchJson(w http.ResponseWriter, entries []*Entry, q string, sq searchQuery, matcher func(*Entry) *search.Matcher, qu string, offset, limit int) {
+	abs := func(href string) string { return app.url.ResolveReference(mustParseURL(href)).String() }
+	offset = min(len(entries), max(0, offset))
+	ret := searchResponse{
+		Query:   q,
+		Total:   len(entries),
+		Offset:  offset,
+		Limit:   limit,
+		Results: []searchResult{},
+	}
+	if next := offset + limit; next < len(entries) {
+		ret.Next = abs(qu + "&" + "format" + "=" + formatJson + "&" + "offset" + "=" + strconv.Itoa(next))
+	}
+	for _, ent := range entries[offset:min(len(entries), offset+limit)] {
+		m := matcher(ent)
+		res := searchResult{
+			Id:        string(ent.Id),
+			Url:       abs(path.Join(uriPub, uriPosts, string(ent.Id)) + "/"),
+			Title:     ent.Title.Body,
+			Published: jsonFeedTime(ent.Published),
+			Rank:      sq.rank(ent, m),
+			Matches:   sq.matches(ent, m),
+		}
+		if len(ent.Links) > 0 {
+			res.Link = ent.Links[0].Href
+		}
+		for _, cat := range ent.Categories {
+			res.Tags = append(res.Tags, cat.Term)
+		}
+		ret.Results = append(ret.Results, res)
+	}
+
+	w.Header().Set("Content-Type", string(mimeJson)+"; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ret); err != nil {
+		log.Printf("couldn't write search results: %s", err)
+	}
+}
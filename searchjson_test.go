@@ -0,0 +1,142 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+	"testing"
+)
+
+func TestWantsSearchJson(t *testing.T) {
+	t.Parallel()
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/shaarligo.cgi/search/?q=a&format=json", nil)
+	assert.True(t, wantsSearchJson(r), "parameter")
+	r = httptest.NewRequest(http.MethodGet, "http://example.com/shaarligo.cgi/search/?q=a", nil)
+	assert.False(t, wantsSearchJson(r), "aha")
+	r.Header.Set("Accept", "application/json")
+	assert.True(t, wantsSearchJson(r), "negotiated")
+	r = httptest.NewRequest(http.MethodGet, "http://example.com/shaarligo.cgi/search/?q=a&format=jsonfeed", nil)
+	r.Header.Set("Accept", "application/json")
+	assert.False(t, wantsSearchJson(r), "parameter wins")
+}
+
+func TestMatchRanges(t *testing.T) {
+	t.Parallel()
+	matcher := search.New(language.German, search.IgnoreDiacritics, search.IgnoreCase)
+	assert.Equal(t, [][2]int{{0, 7}, {8, 15}}, matchRanges("Foo bar foo bar", []string{"foo", "foo bar", "nix"}, matcher), "sorted and merged")
+	assert.Equal(t, [][2]int{{8, 11}}, matchRanges("Grüße Koln", []string{"KOL"}, matcher), "bytes")
+	en := search.New(language.English, search.IgnoreDiacritics, search.IgnoreCase)
+	assert.Equal(t, [][2]int{{0, 3}, {4, 8}}, matchRanges("Foo bär", []string{"foo", "BAR"}, en), "ignores diacritics")
+	assert.Equal(t, [][2]int{{0, 3}}, matchRanges("Foo bär", []string{"foo", "BAR"}, matcher), "but not german umlauts")
+}
+
+func TestSnippet(t *testing.T) {
+	t.Parallel()
+	m := snippet("Grüße aus Köln", [][2]int{{12, 16}})
+	assert.Equal(t, "Grüße aus Köln", m.Snippet, "aha")
+	assert.Equal(t, []searchHighlight{{10, 13}}, m.Highlights, "runes")
+
+	long := ""
+	for i := 0; i < 30; i++ {
+		long += "lorem ipsum "
+	}
+	m = snippet(long+"hit"+long, [][2]int{{len(long), len(long) + 3}})
+	assert.Equal(t, 1+snippetLength+1, len([]rune(m.Snippet)), "ellipsis on both ends")
+	assert.Equal(t, []searchHighlight{{1 + snippetBefore, 1 + snippetBefore + 3}}, m.Highlights, "aha")
+	assert.Equal(t, "hit", string([]rune(m.Snippet)[1+snippetBefore:1+snippetBefore+3]), "aha")
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	t.Parallel()
+	matcher := search.New(language.German, search.IgnoreDiacritics, search.IgnoreCase)
+	ent := entry("Über Go", "Go is fun, go!", "#golang #fun")
+	ent.Links = []Link{{Href: "https://www.example.com/go"}}
+	sq, err := parseSearchQuery("go -fun tag:fun site:example.com OR #lang")
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, []searchMatch{
+		{Field: "title", Snippet: "Über Go", Highlights: []searchHighlight{{5, 7}}},
+		{Field: "content", Snippet: "Go is fun, go!", Highlights: []searchHighlight{{0, 2}, {11, 13}}},
+		{Field: "tags", Snippet: "#golang #fun", Highlights: []searchHighlight{{0, 7}, {8, 12}}},
+		{Field: "link", Snippet: "https://www.example.com/go", Highlights: []searchHighlight{{8, 23}}},
+	}, sq.matches(ent, matcher), "aha")
+
+	ent.Links = []Link{{Href: "http://%E4%BE%8B.jp/"}}
+	sq, err = parseSearchQuery("site:jp")
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, []searchMatch{
+		{Field: "link", Snippet: "http://%E4%BE%8B.jp/", Highlights: []searchHighlight{}},
+	}, sq.matches(ent, matcher), "percent-encoded host, no highlight")
+}
+
+func TestHandleSearchJson(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{
+		cfg: Config{LinksPerPage: 2, PwdBcrypt: "-"},
+		ses: sessions.NewSession(nil, "test"),
+		url: *mustParseURL("http://example.com/sub/"),
+	}
+	feed := Feed{}
+	for i, id := range []Id{"a", "b", "c"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: "Hello " + string(id)}, Published: iso8601(time.Date(2021, 1, 1+i, 0, 0, 0, 0, time.UTC))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.SaveFeed(feed), "aha")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/search/?q=hello", nil)
+	r.Header.Set("Accept", "application/json")
+	app.handleSearch()(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"), "aha")
+	assert.Equal(t, "Accept", w.Header().Get("Vary"), "negotiated, so caches must tell apart")
+	ret := searchResponse{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &ret), "aha")
+	assert.Equal(t, "hello", ret.Query, "aha")
+	assert.Equal(t, 3, ret.Total, "aha")
+	assert.Equal(t, 0, ret.Offset, "aha")
+	assert.Equal(t, 2, ret.Limit, "aha")
+	assert.Equal(t, "http://example.com/sub/shaarligo.cgi/search/?q=hello&format=json&offset=2", ret.Next, "aha")
+	assert.Equal(t, 2, len(ret.Results), "paged")
+	assert.Equal(t, searchResult{
+		Id:        "c",
+		Url:       "http://example.com/sub/o/p/c/",
+		Title:     "Hello c",
+		Published: "2021-01-03T00:00:00Z",
+		Rank:      2,
+		Matches:   []searchMatch{{Field: "title", Snippet: "Hello c", Highlights: []searchHighlight{{0, 5}}}},
+	}, ret.Results[0], "newest first with equal rank")
+
+	w = httptest.NewRecorder()
+	app.handleSearch()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/search/?q=hello&format=json&offset=2", nil))
+	ret = searchResponse{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &ret), "aha")
+	assert.Equal(t, 1, len(ret.Results), "last page")
+	assert.Equal(t, "Accept", w.Header().Get("Vary"), "aha")
+	assert.Equal(t, "", ret.Next, "last page")
+}
@@ -0,0 +1,293 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/search"
+)
+
+// Search query language, see parseSearchQuery.
+//
+// Unlike before, where rankEntryTerms summed over the words and any of them
+// sufficed, all terms must match now. Use OR for the former. A lone OR, '-' or
+// an unbalanced quote are errors (400) now rather than words to search for.
+//
+//   foo "foo bar" #tag     words, phrases and tags, all must match
+//   -foo -tag:x            exclusion
+//   foo OR bar             either side, binds weaker than the implicit AND
+//   tag:go                 exact tag
+//   site:example.com       link host, including subdomains
+//   before:2021-03         published before, YYYY, YYYY-MM or YYYY-MM-DD
+//   after:2021             published after
+//   has:geo has:image      with GeoRSS point or thumbnail
+//   is:note                without link
+
+const (
+	fieldTag    = "tag"
+	fieldSite   = "site"
+	fieldBefore = "before"
+	fieldAfter  = "after"
+	fieldHas    = "has"
+	fieldIs     = "is"
+)
+
+var searchFieldValues = map[string][]string{
+	fieldTag:    nil,
+	fieldSite:   nil,
+	fieldBefore: nil,
+	fieldAfter:  nil,
+	fieldHas:    {"geo", "image"},
+	fieldIs:     {"note"},
+}
+
+var searchDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+type searchTerm struct {
+	Not   bool
+	Field string // "" for words and phrases
+	Value string
+}
+
+// disjunction of conjunctions
+type searchQuery [][]searchTerm
+
+type searchQueryError struct {
+	Col int // 1-based, in runes
+	Msg string
+}
+
+func (e searchQueryError) Error() string {
+	return fmt.Sprintf("query column %d: %s", e.Col, e.Msg)
+}
+
+func parseSearchQuery(q string) (searchQuery, error) {
+	rs := []rune(q)
+	pos := 0
+	fail := func(at int, format string, a ...interface{}) (searchQuery, error) {
+		return nil, searchQueryError{Col: 1 + at, Msg: fmt.Sprintf(format, a...)}
+	}
+	// the quoted string at pos, without the quotes
+	quoted := func() (string, bool) {
+		end := pos + 1
+		for end < len(rs) && '"' != rs[end] {
+			end++
+		}
+		if end >= len(rs) {
+			return "", false
+		}
+		ret := string(rs[pos+1 : end])
+		pos = end + 1
+		return ret, true
+	}
+	// up to whitespace or quote
+	bare := func() string {
+		end := pos
+		for end < len(rs) && !unicode.IsSpace(rs[end]) && '"' != rs[end] {
+			end++
+		}
+		ret := string(rs[pos:end])
+		pos = end
+		return ret
+	}
+
+	ret := searchQuery{}
+	var grp []searchTerm
+	orAt := -1
+	for {
+		for pos < len(rs) && unicode.IsSpace(rs[pos]) {
+			pos++
+		}
+		if pos >= len(rs) {
+			break
+		}
+		start := pos
+		t := searchTerm{}
+		if '-' == rs[pos] {
+			t.Not = true
+			pos++
+			if pos >= len(rs) || unicode.IsSpace(rs[pos]) {
+				return fail(start, "'-' must be followed by a term to exclude")
+			}
+		}
+		if '"' == rs[pos] {
+			v, ok := quoted()
+			if !ok {
+				return fail(pos, "unterminated quote")
+			}
+			if "" == strings.TrimSpace(v) {
+				return fail(start, "empty phrase")
+			}
+			t.Value = v
+		} else {
+			raw := bare()
+			if "OR" == raw && !t.Not {
+				if 0 == len(grp) {
+					return fail(start, "OR must follow a term")
+				}
+				ret = append(ret, grp)
+				grp = nil
+				orAt = start
+				continue
+			}
+			if i := strings.IndexRune(raw, ':'); i > 0 {
+				if _, ok := searchFieldValues[raw[:i]]; ok {
+					t.Field = raw[:i]
+					t.Value = raw[i+1:]
+				}
+			}
+			if "" == t.Field {
+				t.Value = raw
+			} else if "" == t.Value {
+				if pos < len(rs) && '"' == rs[pos] {
+					v, ok := quoted()
+					if !ok {
+						return fail(pos, "unterminated quote")
+					}
+					t.Value = v
+				}
+				if "" == strings.TrimSpace(t.Value) {
+					return fail(start, "'%s:' needs a value", t.Field)
+				}
+			}
+		}
+		if pos < len(rs) && '"' == rs[pos] {
+			return fail(pos, "quote must start a term")
+		}
+		if err := t.validate(); err != nil {
+			return fail(start, "%s", err)
+		}
+		grp = append(grp, t)
+	}
+	if 0 == len(grp) {
+		if orAt >= 0 {
+			return fail(orAt, "OR must be followed by a term")
+		}
+		return fail(0, "empty query")
+	}
+	return append(ret, grp), nil
+}
+
+func (t searchTerm) validate() error {
+	switch t.Field {
+	case fieldBefore, fieldAfter:
+		for _, layout := range searchDateLayouts {
+			if _, err := time.Parse(layout, t.Value); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("'%s:%s' isn't a date, use YYYY, YYYY-MM or YYYY-MM-DD", t.Field, t.Value)
+	case fieldHas, fieldIs:
+		for _, v := range searchFieldValues[t.Field] {
+			if v == t.Value {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown '%s:%s', use one of %s:%s", t.Field, t.Value, t.Field, strings.Join(searchFieldValues[t.Field], " "+t.Field+":"))
+	}
+	return nil
+}
+
+func hostMatches(href, site string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	host := fold(u.Hostname())
+	site = fold(site)
+	return host == site || strings.HasSuffix(host, "."+site)
+}
+
+// rank > 0 for matching text, tags and links, 0 for matching filters
+func (t searchTerm) match(entry *Entry, matcher *search.Matcher) (rank int, ok bool) {
+	switch t.Field {
+	case "":
+		rank = rankEntryTerms(entry, []string{t.Value}, matcher)
+		return rank, rank > 0
+	case fieldTag:
+		for _, cat := range entry.Categories {
+			if fold(cat.Term) == fold(t.Value) {
+				return 5, true
+			}
+		}
+	case fieldSite:
+		if len(entry.Links) > 0 && hostMatches(entry.Links[0].Href, t.Value) {
+			return 3, true
+		}
+	case fieldBefore, fieldAfter:
+		// compare the day in the entry's own time zone, see o/d/
+		day := entry.Published.Format("2006-01-02")[:len(t.Value)]
+		return 0, (fieldBefore == t.Field && day < t.Value) || (fieldAfter == t.Field && day > t.Value)
+	case fieldHas:
+		switch t.Value {
+		case "geo":
+			return 0, nil != entry.GeoRssPoint
+		case "image":
+			return 0, nil != entry.MediaThumbnail
+		}
+	case fieldIs:
+		return 0, 0 == len(entry.Links)
+	}
+	return 0, false
+}
+
+// 0 if not matching
+func (q searchQuery) rank(entry *Entry, matcher *search.Matcher) int {
+	ret := 0
+nextGroup:
+	for _, grp := range q {
+		sum := 0
+		for _, t := range grp {
+			r, ok := t.match(entry, matcher)
+			if ok == t.Not {
+				continue nextGroup
+			}
+			if !t.Not {
+				sum += r
+			}
+		}
+		ret += max(1, sum)
+	}
+	return ret
+}
+
+// terms to look up in the search index per group, see searchIndex.Candidates.
+func (q searchQuery) indexTerms() [][]string {
+	ret := make([][]string, 0, len(q))
+	for _, grp := range q {
+		terms := make([]string, 0, len(grp))
+		for _, t := range grp {
+			if t.Not {
+				continue
+			}
+			switch t.Field {
+			case "", fieldSite:
+				terms = append(terms, t.Value)
+			case fieldTag:
+				terms = append(terms, "#"+t.Value)
+			}
+		}
+		ret = append(ret, terms)
+	}
+	return ret
+}
@@ -0,0 +1,150 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	t.Parallel()
+	q, err := parseSearchQuery(`foo "bar baz" -#qux tag:go -site:example.com OR before:2021-03 has:geo is:note http://a.b/c`)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, searchQuery{
+		{
+			{Value: "foo"},
+			{Value: "bar baz"},
+			{Not: true, Value: "#qux"},
+			{Field: fieldTag, Value: "go"},
+			{Not: true, Field: fieldSite, Value: "example.com"},
+		},
+		{
+			{Field: fieldBefore, Value: "2021-03"},
+			{Field: fieldHas, Value: "geo"},
+			{Field: fieldIs, Value: "note"},
+			{Value: "http://a.b/c"},
+		},
+	}, q, "aha")
+
+	q, err = parseSearchQuery(`  tag:"a b"  -"c"  -OR  `)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, searchQuery{{{Field: fieldTag, Value: "a b"}, {Not: true, Value: "c"}, {Not: true, Value: "OR"}}}, q, "aha")
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	t.Parallel()
+	for q, msg := range map[string]string{
+		``:               "query column 1: empty query",
+		`foo "bar`:       "query column 5: unterminated quote",
+		`foo"bar"`:       "query column 4: quote must start a term",
+		`foo - bar`:      "query column 5: '-' must be followed by a term to exclude",
+		`OR foo`:         "query column 1: OR must follow a term",
+		`foo OR OR bar`:  "query column 8: OR must follow a term",
+		`foo OR`:         "query column 5: OR must be followed by a term",
+		`""`:             "query column 1: empty phrase",
+		`tag:`:           "query column 1: 'tag:' needs a value",
+		`x after:21`:     "query column 3: 'after:21' isn't a date, use YYYY, YYYY-MM or YYYY-MM-DD",
+		`before:2021-13`: "query column 1: 'before:2021-13' isn't a date, use YYYY, YYYY-MM or YYYY-MM-DD",
+		`has:video`:      "query column 1: unknown 'has:video', use one of has:geo has:image",
+		`is:"link"`:      "query column 1: unknown 'is:link', use one of is:note",
+		`tag:"x`:         "query column 5: unterminated quote",
+	} {
+		_, err := parseSearchQuery(q)
+		if assert.NotNil(t, err, q) {
+			assert.Equal(t, msg, err.Error(), q)
+		}
+	}
+}
+
+func TestSearchQueryRank(t *testing.T) {
+	t.Parallel()
+	matcher := search.New(language.German, search.IgnoreDiacritics, search.IgnoreCase)
+	day := func(y int, m time.Month, d int) iso8601 { return iso8601(time.Date(y, m, d, 12, 0, 0, 0, time.UTC)) }
+	a := entry("Foo bar", "Ein Text", "#golang #Städte")
+	a.Published = day(2020, 12, 31)
+	a.Links = []Link{{Href: "https://www.example.com/x"}}
+	a.GeoRssPoint = &GeoRssPoint{Lat: 1, Lon: 2}
+	b := entry("Bar baz", "", "#go")
+	b.Published = day(2021, 3, 1)
+	b.MediaThumbnail = &MediaThumbnail{Url: "http://example.org/i.png"}
+
+	rank := func(q string, ent *Entry) int {
+		sq, err := parseSearchQuery(q)
+		assert.Nil(t, err, q)
+		return sq.rank(ent, matcher)
+	}
+	assert.Equal(t, 4, rank("foo bar", a), "all words")
+	assert.Equal(t, 0, rank("foo bar", b), "all words")
+	assert.Equal(t, 2, rank("bar -foo", b), "exclusion")
+	assert.Equal(t, 0, rank("bar -foo", a), "exclusion")
+	assert.Equal(t, 2, rank(`"foo bar"`, a), "phrase")
+	assert.Equal(t, 0, rank(`"bar foo"`, a), "phrase")
+	assert.Equal(t, 2, rank("foo OR baz", a), "or")
+	assert.Equal(t, 2, rank("foo OR baz", b), "or")
+	assert.Equal(t, 5, rank("tag:GO", b), "exact tag")
+	assert.Equal(t, 0, rank("tag:go", a), "exact tag")
+	assert.Equal(t, 5, rank("tag:stadte", a), "folded tag")
+	assert.Equal(t, 5, rank("#go", a), "tag substrings as before")
+	assert.Equal(t, 3, rank("site:example.com", a), "subdomain")
+	assert.Equal(t, 0, rank("site:ample.com", a), "subdomain")
+	assert.Equal(t, 1, rank("is:note", b), "without link")
+	assert.Equal(t, 0, rank("is:note", a), "without link")
+	assert.Equal(t, 1, rank("has:geo", a), "geo")
+	assert.Equal(t, 0, rank("has:geo", b), "geo")
+	assert.Equal(t, 1, rank("has:image", b), "image")
+	assert.Equal(t, 1, rank("before:2021", a), "before")
+	assert.Equal(t, 0, rank("before:2021-03-01", b), "before")
+	assert.Equal(t, 1, rank("after:2021-02", b), "after")
+	assert.Equal(t, 0, rank("after:2020-12-31", a), "after")
+	assert.Equal(t, 2, rank("bar after:2020", b), "filter and word")
+}
+
+// what used to work differently with the plain rankEntryTerms.
+func TestSearchQueryChangedFromBefore(t *testing.T) {
+	t.Parallel()
+	matcher := search.New(language.German, search.IgnoreDiacritics, search.IgnoreCase)
+	a := entry("Foo bar", "", "")
+	b := entry("Baz", "", "")
+
+	assert.True(t, rankEntryTerms(a, []string{"foo", "baz"}, matcher) > 0, "any word before")
+	assert.True(t, rankEntryTerms(b, []string{"foo", "baz"}, matcher) > 0, "any word before")
+	sq, err := parseSearchQuery("foo baz")
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 0, sq.rank(a, matcher), "all words now")
+	assert.Equal(t, 0, sq.rank(b, matcher), "all words now")
+	sq, err = parseSearchQuery("foo OR baz")
+	assert.Nil(t, err, "aha")
+	assert.True(t, sq.rank(a, matcher) > 0 && sq.rank(b, matcher) > 0, "any word needs OR now")
+
+	for _, q := range []string{"OR", `foo "bar`, "foo -"} {
+		_, err = parseSearchQuery(q)
+		assert.NotNil(t, err, q+" was a search before, is an error now")
+	}
+}
+
+func TestSearchQueryIndexTerms(t *testing.T) {
+	t.Parallel()
+	sq, err := parseSearchQuery(`foo -bar tag:go OR site:example.com has:geo`)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, [][]string{{"foo", "#go"}, {"example.com"}}, sq.indexTerms(), "aha")
+}
@@ -0,0 +1,246 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Keep parsed files in memory while running as a long-lived process.
+//
+// nil when running as a plain CGI, where each request is a fresh process anyway.
+var memCache *fileCache
+
+func init() {
+	// same as static/app/99-lighttpd-shaarligo.conf
+	mime.AddExtensionType(".xslt", "text/xsl; charset=utf-8")
+}
+
+type fileCacheEntry struct {
+	fi  os.FileInfo
+	val interface{}
+}
+
+// parsed file contents, re-read when the file on disk changes.
+type fileCache struct {
+	mu      sync.Mutex
+	entries map[string]fileCacheEntry
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{entries: make(map[string]fileCacheEntry, 3)}
+}
+
+// return the cached value for file or parse and remember it.
+//
+// Callers must not modify what they get but rather copy first.
+func (c *fileCache) load(file string, parse func(string) (interface{}, error)) (interface{}, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[file]; ok && os.SameFile(e.fi, fi) && e.fi.Size() == fi.Size() && e.fi.ModTime().Equal(fi.ModTime()) {
+		return e.val, nil
+	}
+	val, err := parse(file)
+	if err != nil {
+		delete(c.entries, file)
+		return val, err
+	}
+	c.entries[file] = fileCacheEntry{fi: fi, val: val}
+	return val, nil
+}
+
+// run as a standalone webserver, e.g. on a VPS or in a container.
+//
+// $ shaarligo.cgi serve -listen :8080
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flags.String("listen", ":8080", "address to listen at")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	memCache = newFileCache()
+	wg := &sync.WaitGroup{}
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           handleServe(wg),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Printf("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		done <- srv.Shutdown(ctx)
+	}()
+
+	log.Printf("listening at %s", *listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	err := <-done
+	wg.Wait()
+	return err
+}
+
+// forward to the cgi and serve the static files like the webserver configs in
+// static/.htaccess and static/app/99-lighttpd-shaarligo.conf do.
+func handleServe(wg *sync.WaitGroup) http.Handler {
+	cgi := handleMux(wg)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the cgi relies on absolute request urls as provided by a webserver.
+		if !r.URL.IsAbs() {
+			r.URL.Scheme = "http"
+			if nil != r.TLS || "https" == r.Header.Get("X-Forwarded-Proto") {
+				r.URL.Scheme = "https"
+			}
+			r.URL.Host = r.Host
+		}
+
+		h := w.Header()
+		h.Set("Content-Security-Policy", "base-uri 'none'; form-action 'self'; frame-ancestors 'none'; default-src 'none'; style-src 'self' 'unsafe-inline'; script-src 'self' 'sha256-hGqewLn4csF93PEX/0TCk2jdnAytXBZFxFBzKt7wcgo='; connect-src 'self'; font-src 'self'; img-src data: 'self'; media-src 'none';")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+
+		const script = "/" + cgiName
+		p := r.URL.Path
+		switch {
+		case script == p || strings.HasPrefix(p, script+"/"):
+			h.Set("Cache-Control", "no-cache")
+			env := cgiEnv{ScriptName: script, PathInfo: p[len(script):]}
+			cgi(w, r.WithContext(context.WithValue(r.Context(), cgiEnvKey{}, env)))
+		case "/" == p && "" != r.URL.RawQuery:
+			// probe & shaarli
+			http.Redirect(w, r, cgiName+"?"+r.URL.RawQuery, http.StatusFound)
+		default:
+			serveStatic(w, r)
+		}
+	})
+}
+
+// only what a visitor may see, never app/
+func isStaticPath(p string) bool {
+	switch p {
+	case "/", "/index.html", "/favicon.ico", "/robots.txt":
+		return true
+	}
+	for _, prefix := range []string{uriPub, dirThemes} {
+		if strings.HasPrefix(p, "/"+prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func serveStatic(w http.ResponseWriter, r *http.Request) {
+	p := path.Clean(r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && "/" != p {
+		p += "/"
+	}
+	if !isStaticPath(p) || strings.Contains(p, "/.") {
+		serveNotFound(w, r)
+		return
+	}
+	if strings.HasPrefix(p, "/"+dirThemes+"/") {
+		w.Header().Set("Cache-Control", "max-age=604800, public") // 7 days
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	file := filepath.FromSlash(strings.TrimPrefix(p, "/"))
+	if "" == file {
+		file = "."
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		serveNotFound(w, r)
+		return
+	}
+	if fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(p)+"/", http.StatusMovedPermanently)
+			return
+		}
+		// DirectoryIndex index.html index.xml
+		dir := file
+		file = ""
+		for _, idx := range []string{"index.html", "index.xml"} {
+			if fi, err := os.Stat(filepath.Join(dir, idx)); err == nil && !fi.IsDir() {
+				file = filepath.Join(dir, idx)
+				break
+			}
+		}
+		if "" == file {
+			serveNotFound(w, r)
+			return
+		}
+	}
+	// the precompressed sibling if accepted, like .htaccess, see gzipSibling
+	name := filepath.Base(file)
+	if ext := filepath.Ext(name); ".xml" == ext || ".json" == ext {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			if fi, err := os.Stat(file + gzSuffix); err == nil && !fi.IsDir() {
+				file += gzSuffix
+				w.Header().Set("Content-Encoding", "gzip")
+			}
+		}
+	}
+	if f, err := os.Open(file); err != nil {
+		serveNotFound(w, r)
+	} else {
+		defer f.Close()
+		if fi, err := f.Stat(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			http.ServeContent(w, r, name, fi.ModTime(), f) // type by the uncompressed name
+		}
+	}
+}
+
+func serveNotFound(w http.ResponseWriter, r *http.Request) {
+	if byt, err := ioutil.ReadFile(filepath.Join(dirThemes, "current", "404.html")); err == nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(byt)
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,149 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsStaticPath(t *testing.T) {
+	t.Parallel()
+	assert.True(t, isStaticPath("/"), "aha")
+	assert.True(t, isStaticPath("/robots.txt"), "aha")
+	assert.True(t, isStaticPath("/"+uriPubPosts), "aha")
+	assert.True(t, isStaticPath("/themes/current/posts.xslt"), "aha")
+	assert.False(t, isStaticPath("/app/config.yaml"), "aha")
+	assert.False(t, isStaticPath("/"+cgiName), "aha")
+	assert.False(t, isStaticPath("/o"), "aha")
+}
+
+func TestFileCacheReload(t *testing.T) {
+	defer prepTeardown(t)()
+
+	parses := 0
+	parse := func(file string) (interface{}, error) {
+		parses++
+		b, err := ioutil.ReadFile(file)
+		return string(b), err
+	}
+	c := newFileCache()
+	assert.Nil(t, ioutil.WriteFile("a.txt", []byte("one"), 0600), "aha")
+
+	v, err := c.load("a.txt", parse)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "one", v, "aha")
+	v, _ = c.load("a.txt", parse)
+	assert.Equal(t, "one", v, "aha")
+	assert.Equal(t, 1, parses, "cached")
+
+	assert.Nil(t, ioutil.WriteFile("a.txt~", []byte("three"), 0600), "aha")
+	assert.Nil(t, os.Rename("a.txt~", "a.txt"), "aha")
+	v, _ = c.load("a.txt", parse)
+	assert.Equal(t, "three", v, "aha")
+	assert.Equal(t, 2, parses, "reloaded")
+
+	assert.Nil(t, os.Remove("a.txt"), "aha")
+	_, err = c.load("a.txt", parse)
+	assert.True(t, os.IsNotExist(err), "aha")
+}
+
+func TestServeStatic(t *testing.T) {
+	defer prepTeardown(t)()
+
+	assert.Nil(t, os.MkdirAll(filepath.FromSlash(uriPubPosts), 0700), "aha")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(filepath.FromSlash(uriPubPosts), "index.xml"), []byte("<feed/>"), 0600), "aha")
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dirApp, "config.yaml"), []byte("title: A\n"), 0600), "aha")
+
+	ts := httptest.NewServer(handleServe(&sync.WaitGroup{}))
+	defer ts.Close()
+	c := http.Client{Timeout: time.Second, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	r, err := c.Get(ts.URL + "/" + uriPubPosts)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, http.StatusOK, r.StatusCode, "aha")
+	assert.Equal(t, "text/xml; charset=utf-8", r.Header.Get("Content-Type"), "aha")
+	b, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(t, "<feed/>", string(b), "aha")
+
+	r, _ = c.Get(ts.URL + "/" + uriPub + "/" + uriPosts)
+	assert.Equal(t, http.StatusMovedPermanently, r.StatusCode, "aha")
+
+	r, _ = c.Get(ts.URL + "/app/config.yaml")
+	assert.Equal(t, http.StatusNotFound, r.StatusCode, "never app/")
+
+	r, _ = c.Get(ts.URL + "/?post=foo")
+	assert.Equal(t, http.StatusFound, r.StatusCode, "aha")
+	assert.Equal(t, "/"+cgiName+"?post=foo", r.Header.Get("Location"), "aha")
+
+	r, _ = c.Get(ts.URL + "/" + cgiName + "/about/")
+	assert.Equal(t, http.StatusOK, r.StatusCode, "aha")
+	assert.Equal(t, "text/xml; charset=utf-8", r.Header.Get("Content-Type"), "aha")
+}
+
+func TestServeStaticGzip(t *testing.T) {
+	defer prepTeardown(t)()
+
+	file := filepath.Join(filepath.FromSlash(uriPubPosts), "index.xml")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0700), "aha")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("<feed/>"), 0600), "aha")
+	assert.Nil(t, gzipSibling(file, time.Now()), "aha")
+
+	ts := httptest.NewServer(handleServe(&sync.WaitGroup{}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/"+uriPubPosts, nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate") // no transparent decompression by the client
+	r, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, http.StatusOK, r.StatusCode, "aha")
+	assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"), "aha")
+	assert.Equal(t, "text/xml; charset=utf-8", r.Header.Get("Content-Type"), "of the uncompressed")
+	assert.Equal(t, "Accept-Encoding", r.Header.Get("Vary"), "aha")
+	gz, err := gzip.NewReader(r.Body)
+	assert.Nil(t, err, "aha")
+	b, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, "<feed/>", string(b), "aha")
+
+	req.Header.Set("Accept-Encoding", "identity")
+	r, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "", r.Header.Get("Content-Encoding"), "aha")
+	assert.Equal(t, "Accept-Encoding", r.Header.Get("Vary"), "aha")
+	b, _ = ioutil.ReadAll(r.Body)
+	assert.Equal(t, "<feed/>", string(b), "aha")
+
+	assert.Nil(t, removeWithGzipSibling(file), "aha")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("<feed/>"), 0600), "aha")
+	req.Header.Set("Accept-Encoding", "gzip")
+	r, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, "", r.Header.Get("Content-Encoding"), "no sibling")
+	b, _ = ioutil.ReadAll(r.Body)
+	assert.Equal(t, "<feed/>", string(b), "aha")
+}
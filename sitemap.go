@@ -0,0 +1,192 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// o/sitemap.xml https://www.sitemaps.org/protocol.html with all entry
+// permalinks plus the tag and day feeds, split via a sitemap index if huge.
+
+const sitemapFileName = "sitemap.xml"
+const sitemapMaxUrls = 50000
+const fileRobots = "robots.txt"
+
+type sitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapUrlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapUrl `xml:"sitemap"`
+}
+
+// urls of o/p/, all (public) entries, tag and day feeds. Call before
+// PagedFeeds modifies the entries.
+func sitemapUrls(base string, entries []*Entry) []sitemapUrl {
+	var latest iso8601
+	tags := make(map[string]iso8601, len(entries))
+	days := make(map[string]iso8601, len(entries))
+	newer := func(m map[string]iso8601, k string, t iso8601) {
+		if v, ok := m[k]; !ok || v.Before(t) {
+			m[k] = t
+		}
+	}
+	posts := make([]sitemapUrl, 0, len(entries))
+	for _, ent := range entries {
+		mod := ent.Updated
+		if mod.IsZero() {
+			mod = ent.Published
+		}
+		if latest.Before(mod) {
+			latest = mod
+		}
+		posts = append(posts, sitemapUrl{Loc: base + path.Join(uriPub, uriPosts, string(ent.Id)) + "/", LastMod: mod.Format(time.RFC3339)})
+		for _, cat := range ent.Categories {
+			newer(tags, cat.Term, mod)
+		}
+		newer(days, ent.Published.Format(time.RFC3339[:10]), mod)
+	}
+	feeds := func(prefix string, m map[string]iso8601) []sitemapUrl {
+		ret := make([]sitemapUrl, 0, len(m))
+		for k, mod := range m {
+			// tags may contain spaces, umlauts, # etc.
+			ret = append(ret, sitemapUrl{Loc: base + prefix + url.PathEscape(k) + "/", LastMod: mod.Format(time.RFC3339)})
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].Loc < ret[j].Loc })
+		return ret
+	}
+	ret := make([]sitemapUrl, 0, 1+len(posts)+len(tags)+len(days))
+	ret = append(ret, sitemapUrl{Loc: base + uriPubPosts, LastMod: latest.Format(time.RFC3339)})
+	ret = append(ret, posts...)
+	ret = append(ret, feeds(uriPubTags, tags)...)
+	return append(ret, feeds(uriPubDays, days)...)
+}
+
+func saveSitemapXml(dst string, v interface{}) error {
+	tmp := dst + "~"
+	var err error
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		if _, err = w.Write([]byte(xml.Header)); err == nil {
+			enc := xml.NewEncoder(w)
+			enc.Indent("", "  ")
+			if err = enc.Encode(v); err == nil {
+				if err = w.Close(); err == nil {
+					if err = os.Rename(tmp, dst); err == nil {
+						return gzipSibling(dst, time.Now())
+					}
+				}
+			}
+		}
+	}
+	return err
+}
+
+// write o/sitemap.xml, or o/sitemap-<n>.xml and o/sitemap.xml as index if
+// there are more than sitemapMaxUrls.
+func publishSitemap(base string, urls []sitemapUrl) error {
+	dstDirName := filepath.FromSlash(uriPub)
+	if err := os.MkdirAll(dstDirName, newDirPerms); err != nil {
+		return err
+	}
+	part := func(i int) string { return fmt.Sprintf("sitemap-%d.xml", i) }
+	parts := 0
+	if len(urls) <= sitemapMaxUrls {
+		if err := saveSitemapXml(filepath.Join(dstDirName, sitemapFileName), sitemapUrlSet{Urls: urls}); err != nil {
+			return err
+		}
+	} else {
+		idx := sitemapIndex{}
+		for lo := 0; lo < len(urls); lo += sitemapMaxUrls {
+			chunk := urls[lo:min(len(urls), lo+sitemapMaxUrls)]
+			if err := saveSitemapXml(filepath.Join(dstDirName, part(parts)), sitemapUrlSet{Urls: chunk}); err != nil {
+				return err
+			}
+			mod := ""
+			for _, u := range chunk {
+				if u.LastMod > mod { // all RFC3339 UTC or same offset, good enough
+					mod = u.LastMod
+				}
+			}
+			idx.Sitemaps = append(idx.Sitemaps, sitemapUrl{Loc: base + uriPub + "/" + part(parts), LastMod: mod})
+			parts++
+		}
+		if err := saveSitemapXml(filepath.Join(dstDirName, sitemapFileName), idx); err != nil {
+			return err
+		}
+	}
+	// remove parts left over from a bigger sitemap
+	for i := parts; ; i++ {
+		if err := removeWithGzipSibling(filepath.Join(dstDirName, part(i))); err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return err
+		}
+	}
+	return referenceSitemap(fileRobots, base+uriPub+"/"+sitemapFileName)
+}
+
+// set the 'Sitemap:' line of robots.txt to the absolute url, if present.
+func referenceSitemap(file, loc string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	lines := strings.Split(string(b), "\n")
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.ToLower(line), "sitemap:") {
+			lines[i] = "Sitemap: " + loc
+			found = true
+		}
+	}
+	if !found {
+		return nil // the site owner removed it, so be it.
+	}
+	out := strings.Join(lines, "\n")
+	if out == string(b) {
+		return nil
+	}
+	tmp := file + "~"
+	if err = ioutil.WriteFile(tmp, []byte(out), 0644); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSitemapUrls(t *testing.T) {
+	t.Parallel()
+	urls := sitemapUrls("http://example.com/", []*Entry{
+		{Id: "b", Published: iso8601(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)), Categories: []Category{{Term: "go"}}},
+		{Id: "a", Published: iso8601(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)), Updated: iso8601(time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)), Categories: []Category{{Term: "go"}}},
+	})
+	assert.Equal(t, []sitemapUrl{
+		{Loc: "http://example.com/o/p/", LastMod: "2021-01-03T00:00:00Z"},
+		{Loc: "http://example.com/o/p/b/", LastMod: "2021-01-02T00:00:00Z"},
+		{Loc: "http://example.com/o/p/a/", LastMod: "2021-01-03T00:00:00Z"},
+		{Loc: "http://example.com/o/t/go/", LastMod: "2021-01-03T00:00:00Z"},
+		{Loc: "http://example.com/o/d/2021-01-01/", LastMod: "2021-01-03T00:00:00Z"},
+		{Loc: "http://example.com/o/d/2021-01-02/", LastMod: "2021-01-02T00:00:00Z"},
+	}, urls, "aha")
+}
+
+func TestReferenceSitemap(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, referenceSitemap("robots.txt", "http://example.com/o/sitemap.xml"), "missing is fine")
+	assert.Nil(t, ioutil.WriteFile("robots.txt", []byte("User-agent: *\nDisallow: /shaarligo.cgi\n\nSitemap: o/sitemap.xml\n"), 0644), "aha")
+	assert.Nil(t, referenceSitemap("robots.txt", "http://example.com/o/sitemap.xml"), "aha")
+	b, _ := ioutil.ReadFile("robots.txt")
+	assert.Equal(t, "User-agent: *\nDisallow: /shaarligo.cgi\n\nSitemap: http://example.com/o/sitemap.xml\n", string(b), "aha")
+}
+
+func TestPublishSitemapSplit(t *testing.T) {
+	defer prepTeardown(t)()
+	urls := make([]sitemapUrl, sitemapMaxUrls+1)
+	for i := range urls {
+		urls[i] = sitemapUrl{Loc: "http://example.com/o/p/" + strconv.Itoa(i) + "/", LastMod: "2021-01-01T00:00:00Z"}
+	}
+	urls[sitemapMaxUrls].LastMod = "2021-01-02T00:00:00Z"
+	assert.Nil(t, publishSitemap("http://example.com/", urls), "aha")
+
+	b, err := ioutil.ReadFile(filepath.Join("o", "sitemap.xml"))
+	assert.Nil(t, err, "aha")
+	idx := sitemapIndex{}
+	assert.Nil(t, xml.Unmarshal(b, &idx), "aha")
+	assert.Equal(t, []sitemapUrl{
+		{Loc: "http://example.com/o/sitemap-0.xml", LastMod: "2021-01-01T00:00:00Z"},
+		{Loc: "http://example.com/o/sitemap-1.xml", LastMod: "2021-01-02T00:00:00Z"},
+	}, idx.Sitemaps, "aha")
+
+	b, err = ioutil.ReadFile(filepath.Join("o", "sitemap-1.xml"))
+	assert.Nil(t, err, "aha")
+	set := sitemapUrlSet{}
+	assert.Nil(t, xml.Unmarshal(b, &set), "aha")
+	assert.Equal(t, 1, len(set.Urls), "aha")
+
+	// shrinking removes the parts
+	assert.Nil(t, publishSitemap("http://example.com/", urls[:2]), "aha")
+	_, err = os.Stat(filepath.Join("o", "sitemap-0.xml"))
+	assert.True(t, os.IsNotExist(err), "aha")
+	b, _ = ioutil.ReadFile(filepath.Join("o", "sitemap.xml"))
+	set = sitemapUrlSet{}
+	assert.Nil(t, xml.Unmarshal(b, &set), "aha")
+	assert.Equal(t, 2, len(set.Urls), "aha")
+}
+
+func TestPublishSitemap(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	_, err := feed.Append(&Entry{Id: "a", Published: iso8601(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))})
+	assert.Nil(t, err, "aha")
+	_, err = feed.Append(&Entry{Id: "p", Private: true, Published: iso8601(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))})
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	b, err := ioutil.ReadFile(filepath.Join("o", "sitemap.xml"))
+	assert.Nil(t, err, "aha")
+	set := sitemapUrlSet{}
+	assert.Nil(t, xml.Unmarshal(b, &set), "aha")
+	assert.Equal(t, []sitemapUrl{
+		{Loc: "http://example.com/o/p/", LastMod: "2021-01-01T00:00:00Z"},
+		{Loc: "http://example.com/o/p/a/", LastMod: "2021-01-01T00:00:00Z"},
+		{Loc: "http://example.com/o/d/2021-01-01/", LastMod: "2021-01-01T00:00:00Z"},
+	}, set.Urls, "without private")
+}
+
+func TestSitemapUrlsEscaped(t *testing.T) {
+	t.Parallel()
+	urls := sitemapUrls("http://example.com/", []*Entry{
+		{Id: "a", Published: iso8601(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)), Categories: []Category{{Term: "Köln"}, {Term: "a b"}, {Term: "c#?"}}},
+	})
+	assert.Equal(t, []sitemapUrl{
+		{Loc: "http://example.com/o/t/K%C3%B6ln/", LastMod: "2021-01-01T00:00:00Z"},
+		{Loc: "http://example.com/o/t/a%20b/", LastMod: "2021-01-01T00:00:00Z"},
+		{Loc: "http://example.com/o/t/c%23%3F/", LastMod: "2021-01-01T00:00:00Z"},
+	}, urls[2:5], "aha")
+}
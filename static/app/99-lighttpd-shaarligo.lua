@@ -0,0 +1,28 @@
+-- serve the precompressed o/**/index.xml.gz, index.json.gz and rss.xml.gz to
+-- clients accepting gzip, but only if present. See 99-lighttpd-shaarligo.conf
+--
+-- https://redmine.lighttpd.net/projects/lighttpd/wiki/Docs_ModMagnet
+
+local path = lighty.env["physical.path"]
+if nil == path then
+  return
+end
+if ("/" == string.sub(path, -1)) then
+  path = path .. "index.xml" -- see index-file.names
+end
+if not (string.match(path, "%.xml$") or string.match(path, "%.json$")) then
+  return
+end
+
+lighty.header["Vary"] = "Accept-Encoding"
+local ae = lighty.request["Accept-Encoding"]
+if nil == ae or nil == string.find(ae, "gzip", 1, true) then
+  return
+end
+local st = lighty.stat(path .. ".gz")
+if nil == st or not st.is_file then
+  return
+end
+-- type see mimetype.assign ".xml.gz", ".json.gz"
+lighty.env["physical.path"] = path .. ".gz"
+lighty.header["Content-Encoding"] = "gzip"
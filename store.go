@@ -0,0 +1,130 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Binary snapshot of the Atom feed storage for fast loading.
+//
+// The Atom file app/var/o.atom stays authoritative, the snapshot app/posts.gob.gz
+// gets rebuilt from it whenever missing or stale.
+
+var fileFeedSnapshot string
+
+func init() {
+	fileFeedSnapshot = filepath.Join(dirApp, "posts.gob.gz")
+}
+
+type feedSnapshot struct {
+	// stat of the Atom file mirrored
+	AtomSize    int64
+	AtomModTime time.Time
+	Feed        Feed
+	Index       map[Id]int // Id -> offset into Feed.Entries
+}
+
+func (snap feedSnapshot) mirrors(fi os.FileInfo) bool {
+	return snap.AtomSize == fi.Size() && snap.AtomModTime.Equal(fi.ModTime())
+}
+
+func indexEntries(entries []*Entry) map[Id]int {
+	ret := make(map[Id]int, len(entries))
+	for idx, ent := range entries {
+		ret[ent.Id] = idx
+	}
+	return ret
+}
+
+// load from the snapshot if fresh, otherwise from the Atom file and rebuild the snapshot.
+func loadFeedStore(fileAtom, fileSnap string) (Feed, error) {
+	fi, err := os.Stat(fileAtom)
+	if err != nil {
+		return Feed{}, err
+	}
+	if snap, err := loadFeedSnapshot(fileSnap); err == nil && snap.mirrors(fi) {
+		snap.Feed.index = snap.Index
+		return snap.Feed, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		log.Printf("ignore snapshot %s: %s", fileSnap, err)
+	}
+
+	feed, err := loadFeedFile(fileAtom)
+	if err != nil {
+		return feed, err
+	}
+	if err := saveFeedSnapshot(feed, fi, fileSnap); err != nil {
+		log.Printf("couldn't write snapshot %s: %s", fileSnap, err)
+	}
+	feed.index = indexEntries(feed.Entries)
+	return feed, nil
+}
+
+func loadFeedSnapshot(file string) (feedSnapshot, error) {
+	defer un(trace("loadFeedSnapshot"))
+	snap := feedSnapshot{}
+	f, err := os.Open(file)
+	if err != nil {
+		return snap, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return snap, err
+	}
+	defer gz.Close()
+	if err = gob.NewDecoder(gz).Decode(&snap); err == nil && len(snap.Index) != len(snap.Feed.Entries) {
+		err = fmt.Errorf("index has %d but feed %d entries", len(snap.Index), len(snap.Feed.Entries))
+	}
+	return snap, err
+}
+
+// write atomically via tmp file and rename, like Feed.SaveToFile.
+//
+// fi is the stat of the Atom file the snapshot mirrors.
+func saveFeedSnapshot(feed Feed, fi os.FileInfo, file string) error {
+	defer un(trace("saveFeedSnapshot"))
+	snap := feedSnapshot{
+		AtomSize:    fi.Size(),
+		AtomModTime: fi.ModTime(),
+		Feed:        feed,
+		Index:       indexEntries(feed.Entries),
+	}
+	tmp := file + "~"
+	var err error
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		gz := gzip.NewWriter(w)
+		if err = gob.NewEncoder(gz).Encode(snap); err == nil {
+			if err = gz.Close(); err == nil {
+				if err = w.Close(); err == nil {
+					return os.Rename(tmp, file)
+				}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFeedStoreSnapshot(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+
+	feed := Feed{Id: "a"}
+	for _, id := range []Id{"x", "y", "z"} {
+		_, err := feed.Append(&Entry{Id: id, Title: HumanText{Body: "T " + string(id)}, Published: iso8601(mustParseRFC3339("2017-11-01T00:00:00+01:00"))})
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, feed.SaveToFile(fileFeedStorage), "aha")
+
+	_, err := os.Stat(fileFeedSnapshot)
+	assert.True(t, os.IsNotExist(err), "not yet")
+	f0, err := loadFeedStore(fileFeedStorage, fileFeedSnapshot)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 3, len(f0.Entries), "aha")
+	_, err = os.Stat(fileFeedSnapshot)
+	assert.Nil(t, err, "rebuilt")
+
+	snap, err := loadFeedSnapshot(fileFeedSnapshot)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 3, len(snap.Index), "aha")
+	assert.Equal(t, "T y", snap.Feed.Entries[snap.Index["y"]].Title.Body, "aha")
+	assert.True(t, time.Time(snap.Feed.Entries[0].Published).Equal(mustParseRFC3339("2017-11-01T00:00:00+01:00")), "iso8601 via gob")
+
+	f1, err := loadFeedStore(fileFeedStorage, fileFeedSnapshot)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, f0.Entries, f1.Entries, "from snapshot")
+	idx, ent := f1.findEntryById("z")
+	assert.Equal(t, "T z", ent.Title.Body, "indexed")
+	assert.Equal(t, snap.Index["z"], idx, "indexed")
+
+	// Atom file changed behind our back -> stale
+	feed.Entries = feed.Entries[:1]
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, feed.SaveToFile(fileFeedStorage), "aha")
+	f2, err := loadFeedStore(fileFeedStorage, fileFeedSnapshot)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 1, len(f2.Entries), "rebuilt")
+
+	// garbage snapshot -> rebuilt
+	assert.Nil(t, ioutil.WriteFile(fileFeedSnapshot, []byte("garbage"), 0600), "aha")
+	f3, err := loadFeedStore(fileFeedStorage, fileFeedSnapshot)
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 1, len(f3.Entries), "aha")
+	snap, err = loadFeedSnapshot(fileFeedSnapshot)
+	assert.Nil(t, err, "rebuilt")
+}
+
+func TestFindEntryByIdStaleIndex(t *testing.T) {
+	t.Parallel()
+	feed := Feed{Entries: []*Entry{{Id: "a"}, {Id: "b"}}, index: map[Id]int{"a": 1, "b": 5}}
+	idx, ent := feed.findEntryById("a")
+	assert.Equal(t, 0, idx, "falls back to scan")
+	assert.Equal(t, Id("a"), ent.Id, "aha")
+	idx, _ = feed.findEntryById("b")
+	assert.Equal(t, 1, idx, "aha")
+}
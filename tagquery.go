@@ -0,0 +1,141 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dynamic tag intersection and exclusion, e.g.
+// shaarligo.cgi/t/?all=go+security&not=rant
+
+// split tag query parameters at blanks and commas, drop a leading #.
+func parseTagList(vals []string) []string {
+	ret := make([]string, 0, len(vals))
+	for _, val := range vals {
+		for _, tag := range strings.FieldsFunc(val, func(r rune) bool { return ',' == r || ' ' == r || '\t' == r }) {
+			if tag = strings.TrimPrefix(tag, "#"); "" != tag {
+				ret = append(ret, tag)
+			}
+		}
+	}
+	return ret
+}
+
+// entries having all tags of all and none of not.
+func tagFilter(all, not []string) func(*Entry) bool {
+	return func(entry *Entry) bool {
+		has := make(map[string]bool, len(entry.Categories))
+		for _, cat := range entry.Categories {
+			has[cat.Term] = true
+		}
+		for _, tag := range all {
+			if !has[tag] {
+				return false
+			}
+		}
+		for _, tag := range not {
+			if has[tag] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (feed Feed) TagQuery(all, not []string) Feed {
+	defer un(trace("Feed.TagQuery"))
+	filter := tagFilter(all, not)
+	entries := make([]*Entry, 0, len(feed.Entries))
+	for _, entry := range feed.Entries {
+		if filter(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Sort(ByPublishedDesc(entries))
+	feed.Entries = entries
+	return feed
+}
+
+func tagQuerySubtitle(all, not []string) string {
+	parts := make([]string, 0, len(all)+len(not))
+	for _, tag := range all {
+		parts = append(parts, "#"+tag)
+	}
+	for _, tag := range not {
+		parts = append(parts, "-#"+tag)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (app *Server) handleTagQuery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		if !app.cfg.IsConfigured() {
+			http.Redirect(w, r, cgiName+"/config", http.StatusPreconditionFailed)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			app.KeepAlive(w, r, now)
+			query := r.URL.Query()
+			all := parseTagList(query["all"])
+			not := parseTagList(query["not"])
+			if 0 == len(all)+len(not) {
+				http.Redirect(w, r, path.Join("..", "..", uriPub, uriTags)+"/", http.StatusFound)
+				return
+			}
+			limit := max(1, app.cfg.LinksPerPage)
+			offset := 0
+			if o := query["offset"]; o != nil {
+				offset, _ = strconv.Atoi(o[0]) // just ignore conversion errors. 0 is a fine fallback
+			}
+			params := make([]string, 0, 2)
+			if 0 < len(all) {
+				params = append(params, "all"+"="+url.QueryEscape(strings.Join(all, " ")))
+			}
+			if 0 < len(not) {
+				params = append(params, "not"+"="+url.QueryEscape(strings.Join(not, " ")))
+			}
+			qu := cgiName + "/" + uriTags + "/" + "?" + strings.Join(params, "&")
+
+			feed, _ := LoadFeed()
+			if !app.IsLoggedIn(now) {
+				feed.Entries = publicEntries(feed.Entries)
+			}
+			ret := feed.TagQuery(all, not)
+
+			ret.XmlBase = Iri(app.url.String())
+			ret.Id = Id(app.url.ResolveReference(mustParseURL(qu)).String())
+			ret.Subtitle = &HumanText{Body: tagQuerySubtitle(all, not)}
+			ret.Generator = &Generator{Uri: myselfNamespace, Version: version, Body: "🌺 ShaarliGo"}
+
+			app.serveDynamicFeed(w, r, ret, qu, offset, limit, now)
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
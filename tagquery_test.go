@@ -0,0 +1,101 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseTagList(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []string{"go", "security", "rant"}, parseTagList([]string{"go security", "#rant,"}), "aha")
+	assert.Equal(t, []string{}, parseTagList(nil), "aha")
+}
+
+func TestTagQuery(t *testing.T) {
+	t.Parallel()
+	ent := func(id string, day int, tags ...string) *Entry {
+		ret := &Entry{Id: Id(id), Published: iso8601(time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC))}
+		for _, tag := range tags {
+			ret.Categories = append(ret.Categories, Category{Term: tag})
+		}
+		return ret
+	}
+	feed := Feed{Entries: []*Entry{
+		ent("a", 1, "go", "security"),
+		ent("b", 3, "go", "security", "rant"),
+		ent("c", 2, "go"),
+		ent("d", 4, "go", "security"),
+	}}
+	ids := func(f Feed) (ret []Id) {
+		for _, e := range f.Entries {
+			ret = append(ret, e.Id)
+		}
+		return
+	}
+	assert.Equal(t, []Id{"d", "b", "a"}, ids(feed.TagQuery([]string{"go", "security"}, nil)), "all, newest first")
+	assert.Equal(t, []Id{"d", "a"}, ids(feed.TagQuery([]string{"go", "security"}, []string{"rant"})), "all but not")
+	assert.Equal(t, []Id{"c"}, ids(feed.TagQuery(nil, []string{"security"})), "just not")
+	assert.Equal(t, 4, len(feed.Entries), "untouched")
+	assert.Equal(t, "#go #security -#rant", tagQuerySubtitle([]string{"go", "security"}, []string{"rant"}), "aha")
+}
+
+func TestHandleTagQuery(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var"), 0700), "aha")
+	app := Server{
+		cfg: Config{LinksPerPage: 1, PwdBcrypt: "-"},
+		ses: sessions.NewSession(nil, "test"),
+		url: *mustParseURL("http://example.com/sub/"),
+	}
+	feed := Feed{}
+	for i, id := range []Id{"a", "b", "c"} {
+		_, err := feed.Append(&Entry{Id: id, Published: iso8601(time.Date(2021, 1, 1+i, 0, 0, 0, 0, time.UTC)), Categories: []Category{{Term: "go"}, {Term: "security"}}})
+		assert.Nil(t, err, "aha")
+	}
+	_, err := feed.Append(&Entry{Id: "p", Private: true, Categories: []Category{{Term: "go"}, {Term: "security"}}})
+	assert.Nil(t, err, "aha")
+	assert.Nil(t, app.SaveFeed(feed), "aha")
+
+	w := httptest.NewRecorder()
+	app.handleTagQuery()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/t/?all=go+%23security&not=rant&offset=1", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "aha")
+	ret := Feed{}
+	assert.Nil(t, xml.Unmarshal(w.Body.Bytes(), &ret), "aha")
+	assert.Equal(t, 1, len(ret.Entries), "paged")
+	assert.Equal(t, Id("http://example.com/sub/o/p/b/"), ret.Entries[0].Id, "aha")
+	const qu = "shaarligo.cgi/t/?all=go+security&not=rant"
+	assert.Equal(t, qu+"&offset=1", LinkRelSelf(ret.Links).Href, "aha")
+	assert.Equal(t, qu, LinkRel(relFirst, ret.Links).Href, "aha")
+	assert.Equal(t, qu+"&offset=2", LinkRel(relLast, ret.Links).Href, "aha")
+	assert.Equal(t, qu+"&offset=0", LinkRel(relPrevious, ret.Links).Href, "aha")
+	assert.Equal(t, qu+"&offset=2", LinkRel(relNext, ret.Links).Href, "aha")
+
+	w = httptest.NewRecorder()
+	app.handleTagQuery()(w, httptest.NewRequest(http.MethodGet, "http://example.com/sub/shaarligo.cgi/t/", nil))
+	assert.Equal(t, http.StatusFound, w.Code, "aha")
+}
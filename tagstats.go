@@ -0,0 +1,146 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// o/t/stats.json, per tag the number of posts, first and last use and the
+// tags most often used together with it, e.g.
+// {"go":{"count":3,"first":"2021-01-01T…","last":"…","related":[{"tag":"security","count":2}]}}
+
+const tagStatsFileName = "stats.json"
+const tagStatsRelated = 10 // top co-occurring tags per tag
+
+type tagCount struct {
+	Term  string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type tagStat struct {
+	Count   int        `json:"count"`
+	First   string     `json:"first"`
+	Last    string     `json:"last"`
+	Related []tagCount `json:"related"`
+}
+
+// most frequent first, then by term.
+func topTagCounts(counts map[string]int, n int) []tagCount {
+	ret := make([]tagCount, 0, len(counts))
+	for term, count := range counts {
+		ret = append(ret, tagCount{Term: term, Count: count})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count == ret[j].Count {
+			return ret[i].Term < ret[j].Term
+		}
+		return ret[i].Count > ret[j].Count
+	})
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+func tagStats(entries []*Entry) map[string]tagStat {
+	type acc struct {
+		count       int
+		first, last iso8601
+		with        map[string]int
+	}
+	accs := make(map[string]*acc, len(entries))
+	for _, ent := range entries {
+		for _, cat := range ent.Categories {
+			a := accs[cat.Term]
+			if nil == a {
+				a = &acc{first: ent.Published, last: ent.Published, with: map[string]int{}}
+				accs[cat.Term] = a
+			}
+			a.count++
+			if ent.Published.Before(a.first) {
+				a.first = ent.Published
+			}
+			if ent.Published.After(a.last) {
+				a.last = ent.Published
+			}
+			for _, other := range ent.Categories {
+				if other.Term != cat.Term {
+					a.with[other.Term]++
+				}
+			}
+		}
+	}
+	ret := make(map[string]tagStat, len(accs))
+	for term, a := range accs {
+		ret[term] = tagStat{
+			Count:   a.count,
+			First:   a.first.Format(time.RFC3339),
+			Last:    a.last.Format(time.RFC3339),
+			Related: topTagCounts(a.with, tagStatsRelated),
+		}
+	}
+	return ret
+}
+
+// the tags most often used together with term as Categories with counts as
+// labels, sorted by term like AggregateCategories.
+func relatedCategories(entries []*Entry, term string) []Category {
+	with := make(map[string]int, len(entries))
+	for _, ent := range entries {
+		for _, cat := range ent.Categories {
+			if cat.Term != term {
+				with[cat.Term]++
+			}
+		}
+	}
+	top := topTagCounts(with, tagStatsRelated)
+	ret := make([]Category, 0, len(top))
+	for _, tc := range top {
+		ret = append(ret, Category{Term: tc.Term, Label: strconv.Itoa(tc.Count)})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Term < ret[j].Term })
+	return ret
+}
+
+// write o/t/stats.json for the given (public) entries.
+func publishTagStats(entries []*Entry) error {
+	dstDirName := filepath.FromSlash(uriPubTags)
+	dst := filepath.Join(dstDirName, tagStatsFileName)
+	tmp := dst + "~"
+	var err error
+	if err = os.MkdirAll(dstDirName, newDirPerms); err == nil {
+		var w *os.File
+		if w, err = os.Create(tmp); err == nil {
+			defer w.Close() // just to be sure
+			if err = json.NewEncoder(w).Encode(tagStats(entries)); err == nil {
+				if err = w.Close(); err == nil {
+					if err = os.Rename(tmp, dst); err == nil {
+						return gzipSibling(dst, time.Now())
+					}
+				}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func tagStatsTestEntries() []*Entry {
+	ent := func(id string, day int, tags ...string) *Entry {
+		ret := &Entry{Id: Id(id), Title: HumanText{Body: id}, Published: iso8601(time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC))}
+		for _, tag := range tags {
+			ret.Categories = append(ret.Categories, Category{Term: tag})
+		}
+		return ret
+	}
+	return []*Entry{
+		ent("a", 1, "go", "security"),
+		ent("b", 3, "go", "security", "rant"),
+		ent("c", 2, "go", "rant"),
+		ent("d", 4, "go", "security"),
+	}
+}
+
+func TestTagStats(t *testing.T) {
+	t.Parallel()
+	stats := tagStats(tagStatsTestEntries())
+	assert.Equal(t, 3, len(stats), "aha")
+	assert.Equal(t, tagStat{
+		Count:   4,
+		First:   "2021-01-01T00:00:00Z",
+		Last:    "2021-01-04T00:00:00Z",
+		Related: []tagCount{{Term: "security", Count: 3}, {Term: "rant", Count: 2}},
+	}, stats["go"], "aha")
+	assert.Equal(t, []tagCount{{Term: "go", Count: 2}, {Term: "security", Count: 1}}, stats["rant"].Related, "aha")
+	assert.Equal(t, "2021-01-02T00:00:00Z", stats["rant"].First, "aha")
+}
+
+func TestRelatedCategories(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []Category{{Term: "go", Label: "2"}, {Term: "security", Label: "1"}}, relatedCategories(tagStatsTestEntries()[1:3], "rant"), "by term")
+	assert.Equal(t, []Category{}, relatedCategories(nil, "rant"), "aha")
+}
+
+func TestPublishTagStats(t *testing.T) {
+	defer prepTeardown(t)()
+	app := Server{cfg: Config{LinksPerPage: 10}}
+	feed := Feed{XmlBase: "http://example.com/", Title: HumanText{Body: "A"}}
+	for _, ent := range tagStatsTestEntries() {
+		_, err := feed.Append(ent)
+		assert.Nil(t, err, "aha")
+	}
+	assert.Nil(t, app.PublishFeedsForModifiedEntries(feed, feed.Entries), "aha")
+
+	b, err := ioutil.ReadFile(filepath.Join("o", "t", "stats.json"))
+	assert.Nil(t, err, "aha")
+	stats := map[string]tagStat{}
+	assert.Nil(t, json.Unmarshal(b, &stats), "aha")
+	assert.Equal(t, 2, stats["rant"].Count, "aha")
+
+	b, err = ioutil.ReadFile(filepath.Join("o", "t", "rant", "index.xml"))
+	assert.Nil(t, err, "aha")
+	rant := Feed{}
+	assert.Nil(t, xml.Unmarshal(b, &rant), "aha")
+	assert.Equal(t, []Category{{Term: "go", Label: "2"}, {Term: "security", Label: "1"}}, rant.Categories, "related")
+}
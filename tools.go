@@ -83,6 +83,13 @@ func (app *Server) handleTools() http.HandlerFunc {
 						} else {
 							log.Printf("Import %d entries from %v\n", len(importedFeed.Entries), url)
 							cat := Category{Term: strings.TrimSpace(strings.TrimPrefix(r.FormValue("shaarli_import_tag"), "#"))}
+							unlock, err := lockFeedStorage(timeoutFeedLock)
+							if err != nil {
+								w.Header().Set("Retry-After", "10")
+								http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+								return
+							}
+							defer unlock()
 							feed, _ := LoadFeed()
 							feed.XmlBase = Iri(app.url.String())
 							// feed.Id = feed.XmlBase
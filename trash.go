@@ -0,0 +1,264 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Deleted entries go to app/var/trash.xml first and get purged for good after
+// trash_purge_days (app/config.yaml) or manually at shaarligo.cgi/trash/
+
+const uriTrash = "trash"
+
+var fileTrash string
+
+func init() {
+	fileTrash = filepath.Join(dirApp, "var", uriTrash+".xml")
+}
+
+type trashItem struct {
+	Deleted iso8601 `xml:"deleted"`
+	Entry   *Entry  `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+type trashCan struct {
+	XMLName xml.Name    `xml:"trash"`
+	Items   []trashItem `xml:"item"`
+}
+
+func loadTrash() (trashCan, error) {
+	ret := trashCan{}
+	f, err := os.Open(fileTrash)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return ret, err
+	}
+	defer f.Close()
+	err = xml.NewDecoder(f).Decode(&ret)
+	return ret, err
+}
+
+func (tc trashCan) save() error {
+	tmp := fileTrash + "~"
+	var err error
+	var w *os.File
+	if w, err = os.Create(tmp); err == nil {
+		defer w.Close() // just to be sure
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err = enc.Encode(tc); err == nil {
+			if err = enc.Flush(); err == nil {
+				if err = w.Close(); err == nil {
+					return os.Rename(tmp, fileTrash)
+				}
+			}
+		}
+	}
+	return err
+}
+
+func (tc *trashCan) find(id Id) int {
+	for i, it := range tc.Items {
+		if id == it.Entry.Id {
+			return i
+		}
+	}
+	return -1
+}
+
+// take out of the trash can
+func (tc *trashCan) remove(id Id) *Entry {
+	i := tc.find(id)
+	if i < 0 {
+		return nil
+	}
+	ent := tc.Items[i].Entry
+	tc.Items = append(tc.Items[:i], tc.Items[i+1:]...)
+	return ent
+}
+
+// remove items deleted before the given time, including their history.
+func (tc *trashCan) purgeBefore(t time.Time) int {
+	n := 0
+	items := tc.Items[:0]
+	for _, it := range tc.Items {
+		if time.Time(it.Deleted).Before(t) {
+			purgeHistory(it.Entry.Id)
+			n++
+			continue
+		}
+		items = append(items, it)
+	}
+	tc.Items = items
+	return n
+}
+
+func purgeHistory(id Id) {
+	if err := os.Remove(historyFileName(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("couldn't remove history of %s: %s", id, err)
+	}
+}
+
+func (cfg Config) trashPurgeBefore(now time.Time) time.Time {
+	return now.AddDate(0, 0, -cfg.TrashPurgeDays)
+}
+
+// move into the trash can, purging expired ones. Callers hold lockFeedStorage.
+func (cfg Config) trashEntry(ent *Entry, now time.Time) error {
+	defer un(trace("trashEntry"))
+	tc, err := loadTrash()
+	if err != nil {
+		return err
+	}
+	tc.remove(ent.Id) // in case
+	tc.Items = append([]trashItem{{Deleted: iso8601(now), Entry: ent.clone()}}, tc.Items...)
+	tc.purgeBefore(cfg.trashPurgeBefore(now))
+	return tc.save()
+}
+
+type trashView struct {
+	Id      Id
+	Title   string
+	Deleted string
+	Purge   string
+}
+
+// the items not yet expired, those may linger until the next trashEntry or POST.
+func (app *Server) trashViews(tc trashCan, now time.Time) []trashView {
+	before := app.cfg.trashPurgeBefore(now)
+	ret := make([]trashView, 0, len(tc.Items))
+	for _, it := range tc.Items {
+		if time.Time(it.Deleted).Before(before) {
+			continue
+		}
+		ret = append(ret, trashView{
+			Id:      it.Entry.Id,
+			Title:   it.Entry.Title.Body,
+			Deleted: time.Time(it.Deleted).In(app.tz).Format(time.RFC3339),
+			Purge:   time.Time(it.Deleted).AddDate(0, 0, app.cfg.TrashPurgeDays).In(app.tz).Format(time.RFC3339[:10]),
+		})
+	}
+	return ret
+}
+
+func (app *Server) handleTrash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		if !app.IsLoggedIn(now) {
+			http.Redirect(w, r, cgiName+"?do=login&returnurl="+url.QueryEscape(r.URL.String()), http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			app.KeepAlive(w, r, now)
+			tc, err := loadTrash()
+			if err != nil {
+				http.Error(w, "couldn't load trash: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			views := app.trashViews(tc, now)
+
+			byt, _ := tplTrashHtmlBytes()
+			if tmpl, err := template.New("trash").Parse(string(byt)); err == nil {
+				w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+				io.WriteString(w, xml.Header)
+				io.WriteString(w, `<?xml-stylesheet type='text/xsl' href='../../themes/current/trash.xslt'?>
+`)
+				data := map[string]interface{}{
+					"title": app.cfg.Title,
+					"items": views,
+				}
+				if err := tmpl.Execute(w, data); err != nil {
+					http.Error(w, "Coudln't render trash: "+err.Error(), http.StatusInternalServerError)
+				}
+			}
+		case http.MethodPost:
+			app.KeepAlive(w, r, now)
+			unlock, err := lockFeedStorage(timeoutFeedLock)
+			if err != nil {
+				w.Header().Set("Retry-After", "10")
+				http.Error(w, "couldn't lock feed storage: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			defer unlock()
+			tc, err := loadTrash()
+			if err != nil {
+				http.Error(w, "couldn't load trash: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			tc.purgeBefore(app.cfg.trashPurgeBefore(now))
+
+			if id := Id(r.FormValue("restore")); "" != id {
+				ent := tc.remove(id)
+				if nil == ent {
+					http.NotFound(w, r)
+					return
+				}
+				feed, _ := LoadFeed()
+				feed.XmlBase = Iri(app.url.String())
+				if _, ent0 := feed.findEntryById(id); nil != ent0 {
+					http.Error(w, "Conflict, already exists: "+string(id), http.StatusConflict)
+					return
+				}
+				if _, err := feed.Append(ent); err != nil {
+					http.Error(w, "couldn't restore entry: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if err := app.SaveEntry(feed, ent); err != nil {
+					http.Error(w, "couldn't store feed data: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if err := tc.save(); err != nil {
+					log.Printf("couldn't store trash: %s", err)
+				}
+				// refresh feeds
+				if err := app.PublishFeedsForModifiedEntries(feed, []*Entry{ent}); err != nil {
+					log.Println("couldn't write feeds: ", err.Error())
+					http.Error(w, "couldn't write feeds: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+			} else if id := Id(r.FormValue("purge")); "" != id {
+				if nil == tc.remove(id) {
+					http.NotFound(w, r)
+					return
+				}
+				purgeHistory(id)
+				if err := tc.save(); err != nil {
+					http.Error(w, "couldn't store trash: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			http.Redirect(w, r, "./", http.StatusFound)
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+//
+// Copyright (C) 2021 Marcus Rohrmoser, http://purl.mro.name/ShaarliGo
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTrashEntryAndPurge(t *testing.T) {
+	defer prepTeardown(t)()
+	assert.Nil(t, os.MkdirAll(filepath.Join(dirApp, "var", "history"), 0700), "aha")
+	cfg := Config{TrashPurgeDays: 30}
+
+	tc, err := loadTrash()
+	assert.Nil(t, err, "empty")
+	assert.Equal(t, 0, len(tc.Items), "aha")
+
+	t0 := mustParseRFC3339("2021-01-01T00:00:00Z")
+	assert.Nil(t, ioutil.WriteFile(historyFileName("a"), []byte("<feed/>"), 0600), "aha")
+	assert.Nil(t, cfg.trashEntry(&Entry{Id: "a", Title: HumanText{Body: "A"}}, t0), "aha")
+	assert.Nil(t, cfg.trashEntry(&Entry{Id: "b", Title: HumanText{Body: "B"}}, t0.AddDate(0, 0, 20)), "aha")
+
+	tc, err = loadTrash()
+	assert.Nil(t, err, "aha")
+	assert.Equal(t, 2, len(tc.Items), "aha")
+	assert.Equal(t, Id("b"), tc.Items[0].Entry.Id, "newest first")
+	assert.Equal(t, "A", tc.Items[1].Entry.Title.Body, "aha")
+	assert.True(t, t0.Equal(time.Time(tc.Items[1].Deleted)), "aha")
+
+	// a third one expires the first
+	assert.Nil(t, cfg.trashEntry(&Entry{Id: "c"}, t0.AddDate(0, 0, 31)), "aha")
+	tc, _ = loadTrash()
+	assert.Equal(t, 2, len(tc.Items), "purged")
+	assert.Equal(t, -1, tc.find("a"), "aha")
+	_, err = os.Stat(historyFileName("a"))
+	assert.True(t, os.IsNotExist(err), "history purged, too")
+
+	ent := tc.remove("b")
+	assert.Equal(t, "B", ent.Title.Body, "aha")
+	assert.Nil(t, tc.remove("b"), "gone")
+	assert.Equal(t, 1, len(tc.Items), "aha")
+}
+
+func TestTrashViews(t *testing.T) {
+	t.Parallel()
+	app := Server{cfg: Config{TrashPurgeDays: 30}, tz: time.UTC}
+	t0 := mustParseRFC3339("2021-01-01T00:00:00Z")
+	tc := trashCan{Items: []trashItem{
+		{Deleted: iso8601(t0.AddDate(0, 0, 20)), Entry: &Entry{Id: "b", Title: HumanText{Body: "B"}}},
+		{Deleted: iso8601(t0), Entry: &Entry{Id: "a", Title: HumanText{Body: "A"}}},
+	}}
+	assert.Equal(t, []trashView{
+		{Id: "b", Title: "B", Deleted: "2021-01-21T00:00:00Z", Purge: "2021-02-20"},
+		{Id: "a", Title: "A", Deleted: "2021-01-01T00:00:00Z", Purge: "2021-01-31"},
+	}, app.trashViews(tc, t0.AddDate(0, 0, 30)), "aha")
+	assert.Equal(t, []trashView{
+		{Id: "b", Title: "B", Deleted: "2021-01-21T00:00:00Z", Purge: "2021-02-20"},
+	}, app.trashViews(tc, t0.AddDate(0, 0, 31)), "expired, not yet purged")
+}